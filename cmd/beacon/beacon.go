@@ -8,23 +8,41 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
 
+	"wise-tcp/internal/pow"
 	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/pkg/config"
 	"wise-tcp/pkg/log"
 )
 
+// Config is the part of the server config the beacon shares, so that the
+// server accepts the challenges it issues.
+type Config struct {
+	Pow pow.Config `yaml:"pow"`
+}
+
 var redisClient *redis.Client
 var ctx = context.Background()
 
-func init() {
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-	})
-}
-
 func main() {
+	cfg := config.MustLoad[Config]("cfg/server.yml",
+		config.WithEnvMapper[Config](applyConfigMapping))
+
+	provider, err := pow.NewProvider(cfg.Pow)
+	if err != nil {
+		fmt.Println("Error creating challenge provider:", err)
+		os.Exit(1)
+	}
+	// Signed challenges carry their own proof of issuance; only the others
+	// are stored for the server to look up.
+	stateless := cfg.Pow.Stateless.Enabled
+	if !stateless {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr: cfg.Pow.RedisAddr,
+		})
+	}
+
 	addr := net.UDPAddr{
 		Port: 9002,
 	}
@@ -40,9 +58,6 @@ func main() {
 		}
 	}()
 
-	// todo: configurable difficulty
-	provider := hashcash.NewProvider(hashcash.WithDifficulty(20))
-
 	fmt.Println("Beacon server is running on port 9002...")
 
 	for {
@@ -54,11 +69,11 @@ func main() {
 			continue
 		}
 
-		go handleConnection(conn, clientAddr, provider)
+		go handleConnection(conn, clientAddr, provider, stateless)
 	}
 }
 
-func handleConnection(serverConn *net.UDPConn, clientAddr *net.UDPAddr, provider *hashcash.Provider) {
+func handleConnection(serverConn *net.UDPConn, clientAddr *net.UDPAddr, provider *hashcash.Provider, stateless bool) {
 	raw, err := provider.RawChallenge(clientAddr.String(), 0)
 	if err != nil {
 		log.Errorf("Error generating challenge for client %v: %v\n", clientAddr, err)
@@ -68,28 +83,54 @@ func handleConnection(serverConn *net.UDPConn, clientAddr *net.UDPAddr, provider
 
 	log.Debugf("Generated challenge for client %v: %s", clientAddr, challenge)
 
-	fingerprint, err := raw.Fingerprint()
-	if err != nil {
-		log.Infof("Error generating fingerprint for client %v: %v\n", clientAddr, err)
-		return
+	if !stateless {
+		if err = storeChallenge(raw); err != nil {
+			log.Errorf("Failed to store challenge for client %v: %v", clientAddr, err)
+			_, _ = serverConn.WriteToUDP([]byte("X-Err: internal\n"), clientAddr)
+			return
+		}
 	}
 
-	err = storeFingerprint(fingerprint, challenge, 60*time.Second)
+	_, err = serverConn.WriteToUDP([]byte("X-Challenge: "+challenge+"\n"), clientAddr)
 	if err != nil {
-		log.Errorf("Failed to store fingerprint in Redis: %v", err)
-		_, _ = serverConn.WriteToUDP([]byte("X-Err: internal\n"), clientAddr)
+		log.Errorf("Error sending raw to client %v: %v\n", clientAddr, err)
 		return
 	}
-	log.Debugf("Stored fingerprint in Redis: %s (%s)\n", fingerprint, challenge)
+}
 
-	_, err = serverConn.WriteToUDP([]byte("X-Challenge: "+challenge+"\n"), clientAddr)
+func storeChallenge(raw *hashcash.Challenge) error {
+	challenge := raw.String()
+
+	fingerprint, err := raw.Fingerprint()
 	if err != nil {
-		log.Errorf("Error sending raw to client %v: %v\n", clientAddr, err)
-		return
+		return fmt.Errorf("failed to generate fingerprint: %w", err)
+	}
+
+	if err = storeFingerprint(fingerprint, challenge, 60*time.Second); err != nil {
+		return fmt.Errorf("failed to store fingerprint in Redis: %w", err)
 	}
+	log.Debugf("Stored fingerprint in Redis: %s (%s)", fingerprint, challenge)
+	return nil
 }
 
 func storeFingerprint(fingerprint string, challenge string, expiration time.Duration) error {
 	err := redisClient.Set(ctx, "pow:challenge:"+fingerprint, challenge, expiration).Err()
 	return err
 }
+
+func applyConfigMapping(v *viper.Viper) error {
+	if err := v.BindEnv("pow.diff", "POW_DIFFICULTY"); err != nil {
+		return fmt.Errorf("failed to bind POW_DIFFICULTY: %w", err)
+	}
+	if err := v.BindEnv("pow.redis", "REDIS_ADDR"); err != nil {
+		return fmt.Errorf("failed to bind REDIS_ADDR: %w", err)
+	}
+	if err := v.BindEnv("pow.binding", "POW_BINDING"); err != nil {
+		return fmt.Errorf("failed to bind POW_BINDING: %w", err)
+	}
+	if err := v.BindEnv("pow.alg", "POW_ALG"); err != nil {
+		return fmt.Errorf("failed to bind POW_ALG: %w", err)
+	}
+
+	return nil
+}
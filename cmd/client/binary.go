@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"wise-tcp/internal/proto"
+	"wise-tcp/pkg/log"
+)
+
+const protocolBinary = "binary"
+
+func getQuoteBinary(ctx context.Context, cfg *Config, conn net.Conn, replay string) (string, string, error) {
+	codec := proto.NewCodec(conn)
+
+	if err := helloBinary(conn, codec); err != nil {
+		return "", "", err
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		return "", "", err
+	}
+	payload, err := codec.Expect(proto.MsgChallenge)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to receive challenge: %w", err)
+	}
+	challenge := string(payload)
+
+	log.Debugf("Received challenge: %s", challenge)
+
+	var token string
+	if replay == "" {
+		token = loadToken(cfg)
+	}
+
+	var solution, quote string
+	if token != "" {
+		log.Debug("Presenting saved token instead of solving")
+		if quote, err = sendBinary(cfg, conn, codec, proto.MsgToken, token); err != nil {
+			dropToken(cfg)
+			return "", "", err
+		}
+	} else {
+		if replay == "" {
+			solution, err = newSolver(cfg).SolveContext(ctx, challenge)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to solve challenge: %v", err)
+			}
+			log.Infof("Solved solution: %s", solution)
+		} else {
+			solution = replay
+			log.Debugf("Replaying solution: %s", solution)
+		}
+		if quote, err = sendBinary(cfg, conn, codec, proto.MsgResponse, solution); err != nil {
+			return "", "", err
+		}
+	}
+	if quote, err = withMoreQuotes(ctx, cfg, conn, codec, quote); err != nil {
+		return "", "", err
+	}
+
+	return quote, solution, nil
+}
+
+func helloBinary(conn net.Conn, codec *proto.Codec) error {
+	if err := conn.SetDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		return err
+	}
+	if err := codec.Write(proto.MsgHello, []byte(strconv.Itoa(proto.Version))); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+	version, err := codec.Expect(proto.MsgHello)
+	if err != nil {
+		return fmt.Errorf("failed to receive hello: %w", err)
+	}
+	log.Debugf("Server speaks protocol version %s", version)
+
+	return nil
+}
+
+// sendBinary sends a response or token frame and reads the quote. A token
+// the server hands out with the quote is saved for the next run.
+func sendBinary(cfg *Config, conn net.Conn, codec *proto.Codec, t proto.MessageType, payload string) (string, error) {
+	if err := conn.SetWriteDeadline(time.Now().Add(50 * time.Second)); err != nil {
+		return "", err
+	}
+	if err := codec.Write(t, []byte(payload)); err != nil {
+		return "", fmt.Errorf("failed to send %s: %w", t, err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		return "", err
+	}
+	for {
+		m, err := codec.ExpectOneOf(proto.MsgToken, proto.MsgData)
+		if err != nil {
+			return "", fmt.Errorf("failed to receive quote message: %w", err)
+		}
+		if m.Type == proto.MsgData {
+			return strings.TrimSpace(string(m.Payload)), nil
+		}
+		saveToken(cfg, string(m.Payload))
+	}
+}
@@ -2,17 +2,25 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/viper"
 
 	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/internal/proto"
 	"wise-tcp/pkg/config"
 	"wise-tcp/pkg/log"
+	"wise-tcp/pkg/slog"
+	"wise-tcp/pkg/tlsutil"
 	"wise-tcp/pkg/zap"
 )
 
@@ -24,6 +32,18 @@ type Config struct {
 type AppConfig struct {
 	Name string `yaml:"name"`
 	Prod bool   `yaml:"isProd"`
+	// Logger is the logging backend: zap (the default) or slog.
+	Logger string `yaml:"logger" env:"LOGGER"`
+	// Level is the lowest level logged; empty means debug in development
+	// and info in production.
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Levels override Level for named components and their children.
+	Levels []ComponentLevel `yaml:"levels"`
+}
+
+type ComponentLevel struct {
+	Component string `yaml:"component"`
+	Level     string `yaml:"level"`
 }
 
 type ClientConfig struct {
@@ -31,6 +51,36 @@ type ClientConfig struct {
 	BeaconAddr string `yaml:"beaconAddr" env:"BEACON_ADDR"`
 	Async      bool   `yaml:"async" env:"ASYNC"`
 	TryReplay  bool   `yaml:"tryReplay" env:"TRY_REPLAY"`
+	Workers    int    `yaml:"workers" env:"SOLVER_WORKERS"`
+	Protocol   string `yaml:"protocol" env:"PROTOCOL"`
+	// Requests is the number of quotes fetched over one connection; more
+	// than one needs a server with sessions enabled.
+	Requests int `yaml:"requests" env:"REQUESTS"`
+	// TokenFile stores the bearer token handed out by the server, which is
+	// presented instead of solving a challenge until it is rejected.
+	TokenFile string          `yaml:"tokenFile" env:"TOKEN_FILE"`
+	TLS       ClientTLSConfig `yaml:"tls"`
+	// Retries is how many more times the client tries while the server
+	// is overloaded.
+	Retries int `yaml:"retries" env:"RETRIES"`
+	// MaxDifficulty is the hardest challenge the client solves when the
+	// server is overloaded; it backs off instead of solving a harder one.
+	// Zero solves any challenge.
+	MaxDifficulty int `yaml:"maxDifficulty" env:"MAX_DIFFICULTY"`
+}
+
+type ClientTLSConfig struct {
+	Enabled bool `yaml:"enabled" env:"TLS"`
+	// ServerName overrides the name the server certificate is checked
+	// against; it defaults to the host of the server address.
+	ServerName string `yaml:"serverName" env:"TLS_SERVER_NAME"`
+	// CAFile is the CA bundle the server certificate is verified with; the
+	// system roots are used when it is empty.
+	CAFile string `yaml:"caFile" env:"TLS_CA"`
+	// CertFile and KeyFile are the client certificate for mutual TLS.
+	CertFile   string `yaml:"certFile" env:"TLS_CERT"`
+	KeyFile    string `yaml:"keyFile" env:"TLS_KEY"`
+	MinVersion string `yaml:"minVersion"`
 }
 
 func main() {
@@ -38,7 +88,10 @@ func main() {
 
 	initLogger(cfg.App)
 
-	var fn func(cfg *Config) (string, error)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var fn quoteFunc
 
 	if cfg.Client.Async {
 		fn = getQuoteAsync
@@ -46,7 +99,7 @@ func main() {
 		fn = getQuoteSync
 	}
 
-	resp, err := fn(cfg)
+	resp, err := withRetries(ctx, cfg, fn)
 	if err != nil {
 		log.Errorf("Failed to get quote: %v", err)
 		return
@@ -55,10 +108,10 @@ func main() {
 	fmt.Println(resp)
 }
 
-func getQuoteSync(cfg *Config) (string, error) {
-	quote, solution, err := getQuote(cfg, "")
+func getQuoteSync(ctx context.Context, cfg *Config) (string, error) {
+	quote, solution, err := getQuote(ctx, cfg, "")
 	if cfg.Client.TryReplay {
-		quote, _, err = getQuote(cfg, solution)
+		quote, _, err = getQuote(ctx, cfg, solution)
 		if err != nil {
 			return "", err
 		}
@@ -66,7 +119,7 @@ func getQuoteSync(cfg *Config) (string, error) {
 	return quote, err
 }
 
-func getQuote(cfg *Config, replay string) (string, string, error) {
+func getQuote(ctx context.Context, cfg *Config, replay string) (string, string, error) {
 	conn, err := connect(cfg)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to connect to server: %v", err)
@@ -77,44 +130,132 @@ func getQuote(cfg *Config, replay string) (string, string, error) {
 		}
 	}()
 
-	challenge, err := receiveChallenge(conn)
+	if cfg.Client.Protocol == protocolBinary {
+		return getQuoteBinary(ctx, cfg, conn, replay)
+	}
+
+	challenge, retryAfter, err := receiveChallenge(conn)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to receive challenge: %v", err)
+		return "", "", fmt.Errorf("failed to receive challenge: %w", err)
 	}
 
 	log.Debugf("Received challenge: %s", challenge)
 
+	// An overloaded server only takes a solution of its harder challenge.
+	overloaded := retryAfter > 0
+	if overloaded && cfg.Client.MaxDifficulty > 0 {
+		if d := challengeDifficulty(challenge); d > cfg.Client.MaxDifficulty {
+			return "", "", &overloadedError{after: retryAfter, reason: fmt.Sprintf("challenge difficulty %d too high", d)}
+		}
+	}
+
+	var token string
+	if replay == "" && !overloaded {
+		token = loadToken(cfg)
+	}
+
 	var solution string
-	if replay == "" {
-		solver := hashcash.NewSolver()
-		solution, err = solver.Solve(challenge)
+	var response []byte
+	switch {
+	case token != "":
+		log.Debug("Presenting saved token instead of solving")
+		response = []byte("X-Token: " + token + "\n")
+	case replay == "":
+		solution, err = newSolver(cfg).SolveContext(ctx, challenge)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to solve challenge: %v", err)
 		}
 		log.Infof("Solved solution: %s", solution)
-	} else {
+		response = []byte("X-Response: " + solution + "\n")
+	default:
 		solution = replay
 		log.Debugf("Replaying solution: %s", solution)
+		response = []byte("X-Response: " + solution + "\n")
 	}
 
-	response := []byte("X-Response: " + solution)
 	if err = sendMessage(conn, response); err != nil {
 		return "", "", fmt.Errorf("failed to send solution: %v", err)
 	}
 
-	quote, err := receiveMessage(conn)
+	quote, err := receiveQuote(cfg, conn)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to receive quote message: %v", err)
+		if token != "" {
+			dropToken(cfg)
+		}
+		return "", "", err
 	}
 
-	log.Debug("Received random quote: %s", quote)
+	log.Debugf("Received random quote: %s", quote)
+
+	quote, err = withMoreQuotes(ctx, cfg, conn, nil, quote)
+	if err != nil {
+		return "", "", err
+	}
 
 	return quote, solution, nil
 }
 
-func getQuoteAsync(cfg *Config) (string, error) {
-	udpAddr := "127.0.0.1:9002"
-	udpConn, err := net.Dial("udp", udpAddr)
+func getQuoteAsync(ctx context.Context, cfg *Config) (string, error) {
+	token := loadToken(cfg)
+
+	var solution string
+	if token == "" {
+		var err error
+		if solution, err = solveBeaconChallenge(ctx, cfg); err != nil {
+			return "", err
+		}
+	} else {
+		log.Debug("Presenting saved token instead of solving")
+	}
+
+	tcpConn, err := connect(cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to resource server: %w", err)
+	}
+	defer func(tcpConn net.Conn) {
+		err := tcpConn.Close()
+		if err != nil {
+			log.Error(err)
+		}
+	}(tcpConn)
+
+	var quote string
+	if cfg.Client.Protocol == protocolBinary {
+		codec := proto.NewCodec(tcpConn)
+		if err = helloBinary(tcpConn, codec); err != nil {
+			return "", err
+		}
+		if token != "" {
+			quote, err = sendBinary(cfg, tcpConn, codec, proto.MsgToken, token)
+		} else {
+			quote, err = sendBinary(cfg, tcpConn, codec, proto.MsgResponse, solution)
+		}
+		if err == nil {
+			return withMoreQuotes(ctx, cfg, tcpConn, codec, quote)
+		}
+	} else {
+		response := "X-Response: " + solution
+		if token != "" {
+			response = "X-Token: " + token
+		}
+		if err = sendMessage(tcpConn, []byte(response+"\n")); err != nil {
+			return "", fmt.Errorf("failed to send solution: %v", err)
+		}
+		quote, err = receiveQuote(cfg, tcpConn)
+		if err == nil {
+			return withMoreQuotes(ctx, cfg, tcpConn, nil, quote)
+		}
+	}
+
+	if token != "" {
+		dropToken(cfg)
+	}
+	return "", err
+}
+
+// solveBeaconChallenge fetches a challenge from the UDP beacon and solves it.
+func solveBeaconChallenge(ctx context.Context, cfg *Config) (string, error) {
+	udpConn, err := net.Dial("udp", cfg.Client.BeaconAddr)
 	if err != nil {
 		return "", fmt.Errorf("failed to connect challenge beacon: %w", err)
 	}
@@ -146,35 +287,25 @@ func getQuoteAsync(cfg *Config) (string, error) {
 	challenge := strings.TrimSpace(strings.TrimPrefix(string(buffer[:n]), "X-Challenge:"))
 	log.Debugf("Received challenge: %s", challenge)
 
-	solver := hashcash.NewSolver()
-	solution, err := solver.Solve(challenge)
+	solution, err := newSolver(cfg).SolveContext(ctx, challenge)
 	if err != nil {
 		return "", fmt.Errorf("failed to solve challenge: %v", err)
 	}
 	log.Infof("Solution generated: %s", solution)
 
-	tcpConn, err := connect(cfg)
-	if err != nil {
-		return "", fmt.Errorf("failed to connect to resource server: %w", err)
-	}
-	defer func(tcpConn net.Conn) {
-		err := tcpConn.Close()
-		if err != nil {
-			log.Error(err)
-		}
-	}(tcpConn)
+	return solution, nil
+}
 
-	_, err = tcpConn.Write([]byte("X-Response: " + solution + "\n"))
-	if err != nil {
-		return "", fmt.Errorf("failed to send solution: %v", err)
+func newSolver(cfg *Config) *hashcash.Solver {
+	opts := []hashcash.SolverOption{
+		hashcash.WithProgress(func(p hashcash.Progress) {
+			log.Debugf("Solving: %s", p)
+		}, 5*time.Second),
 	}
-
-	quote, err := bufio.NewReader(tcpConn).ReadString('\n')
-	if err != nil {
-		return "", fmt.Errorf("failed to receive response: %v", err)
+	if cfg.Client.Workers > 0 {
+		opts = append(opts, hashcash.WithWorkers(cfg.Client.Workers))
 	}
-
-	return strings.TrimSpace(quote), nil
+	return hashcash.NewSolver(opts...)
 }
 
 func connect(cfg *Config) (net.Conn, error) {
@@ -183,12 +314,64 @@ func connect(cfg *Config) (net.Conn, error) {
 		serverAddr = os.Args[1]
 	}
 
-	conn, err := net.Dial("tcp", serverAddr)
+	// unix:///path/to/socket selects a Unix socket listener.
+	network := "tcp"
+	if path, ok := strings.CutPrefix(serverAddr, "unix://"); ok {
+		network, serverAddr = "unix", path
+	}
+
+	var conn net.Conn
+	var err error
+	if cfg.Client.TLS.Enabled {
+		var tlsCfg *tls.Config
+		if tlsCfg, err = newTLSConfig(cfg.Client.TLS); err != nil {
+			return nil, err
+		}
+		conn, err = tls.Dial(network, serverAddr, tlsCfg)
+	} else {
+		conn, err = net.Dial(network, serverAddr)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to server: %v", err)
 	}
 
-	return conn, nil
+	return &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func newTLSConfig(cfg ClientTLSConfig) (*tls.Config, error) {
+	minVersion, err := tlsutil.ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		if tlsCfg.RootCAs, err = tlsutil.LoadCertPool(cfg.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// bufferedConn keeps one read buffer for the lifetime of the connection, so
+// that a line arriving together with the previous one is not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
 }
 
 func receiveMessage(conn net.Conn) (string, error) {
@@ -196,9 +379,12 @@ func receiveMessage(conn net.Conn) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	reader := bufio.NewReader(conn)
+	reader, ok := conn.(*bufferedConn)
+	if !ok {
+		reader = &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}
+	}
 
-	response, err := reader.ReadString('\n')
+	response, err := reader.r.ReadString('\n')
 	if err != nil {
 		return "", fmt.Errorf("failed to read message: %w", err)
 	}
@@ -206,6 +392,31 @@ func receiveMessage(conn net.Conn) (string, error) {
 	return strings.TrimSpace(response), nil
 }
 
+// receiveQuote reads the reply to a response or token line. A token the
+// server hands out with the quote is saved for the next run.
+func receiveQuote(cfg *Config, conn net.Conn) (string, error) {
+	for {
+		msg, err := receiveMessage(conn)
+		if err != nil {
+			return "", fmt.Errorf("failed to receive quote message: %v", err)
+		}
+		switch {
+		case msg == serviceUnavailable:
+			return "", &overloadedError{reason: "connection rejected"}
+		case strings.HasPrefix(msg, retryAfterPrefix):
+			// The server wanted a harder challenge solved than the one the
+			// response was for.
+			return "", &overloadedError{after: parseRetryAfter(msg), reason: "harder challenge required"}
+		case strings.HasPrefix(msg, "X-Token:"):
+			saveToken(cfg, strings.TrimSpace(strings.TrimPrefix(msg, "X-Token:")))
+		case strings.HasPrefix(msg, "X-Err:"):
+			return "", errors.New(strings.TrimSpace(strings.TrimPrefix(msg, "X-Err:")))
+		default:
+			return msg, nil
+		}
+	}
+}
+
 func sendMessage(conn net.Conn, solution []byte) error {
 	err := conn.SetWriteDeadline(time.Now().Add(50 * time.Second))
 	if err != nil {
@@ -217,15 +428,28 @@ func sendMessage(conn net.Conn, solution []byte) error {
 	return nil
 }
 
-func receiveChallenge(conn net.Conn) (string, error) {
+// receiveChallenge reads the challenge and the retry hint an overloaded
+// server sends ahead of it, which is zero otherwise.
+func receiveChallenge(conn net.Conn) (string, time.Duration, error) {
 	msg, err := receiveMessage(conn)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+
+	var retryAfter time.Duration
+	switch {
+	case msg == serviceUnavailable:
+		return "", 0, &overloadedError{reason: "connection rejected"}
+	case strings.HasPrefix(msg, retryAfterPrefix):
+		retryAfter = parseRetryAfter(msg)
+		if msg, err = receiveMessage(conn); err != nil {
+			return "", 0, err
+		}
 	}
 
 	challenge := strings.TrimSpace(strings.TrimPrefix(msg, "X-Challenge:"))
 
-	return challenge, nil
+	return challenge, retryAfter, nil
 }
 
 func mustLoadConfig() *Config {
@@ -234,19 +458,61 @@ func mustLoadConfig() *Config {
 }
 
 func initLogger(cfg AppConfig) {
-	logger, err := zap.New(
-		zap.WithName(cfg.Name),
-		zap.WithProd(cfg.Prod),
-	)
+	if err := applyLogLevels(cfg); err != nil {
+		log.Errorf("Failed to set log levels: %v", err)
+	}
+
+	var logger log.Logger
+	var err error
+	switch cfg.Logger {
+	case "", "zap":
+		logger, err = zap.New(zap.WithName(cfg.Name), zap.WithProd(cfg.Prod))
+	case "slog":
+		logger, err = slog.New(slog.WithName(cfg.Name), slog.WithJSON(cfg.Prod))
+	default:
+		err = fmt.Errorf("unknown logger %q", cfg.Logger)
+	}
 	if err != nil {
-		log.Errorf("Failed to initialize zap logger: %v", err)
+		log.Errorf("Failed to initialize logger: %v", err)
 		return
 	}
 
 	log.SetLogger(logger)
 }
 
+// applyLogLevels replaces the default log levels with those of cfg.
+func applyLogLevels(cfg AppConfig) error {
+	def := log.LevelDebug
+	if cfg.Prod {
+		def = log.LevelInfo
+	}
+	if cfg.Level != "" {
+		var err error
+		if def, err = log.ParseLevel(cfg.Level); err != nil {
+			return err
+		}
+	}
+
+	components := make(map[string]log.Level, len(cfg.Levels))
+	for _, c := range cfg.Levels {
+		level, err := log.ParseLevel(c.Level)
+		if err != nil {
+			return fmt.Errorf("component %s: %w", c.Component, err)
+		}
+		components[c.Component] = level
+	}
+
+	log.DefaultLevels().Set(def, components)
+	return nil
+}
+
 func applyConfigMapping(v *viper.Viper) error {
+	if err := v.BindEnv("app.logger", "LOGGER"); err != nil {
+		return fmt.Errorf("failed to bind LOGGER: %w", err)
+	}
+	if err := v.BindEnv("app.level", "LOG_LEVEL"); err != nil {
+		return fmt.Errorf("failed to bind LOG_LEVEL: %w", err)
+	}
 	if err := v.BindEnv("client.serverAddr", "SERVER_ADDR"); err != nil {
 		return fmt.Errorf("failed to bind SERVER_ADDR: %w", err)
 	}
@@ -259,6 +525,39 @@ func applyConfigMapping(v *viper.Viper) error {
 	if err := v.BindEnv("client.tryReplay", "TRY_REPLAY"); err != nil {
 		return fmt.Errorf("failed to bind TRY_REPLAY: %w", err)
 	}
+	if err := v.BindEnv("client.protocol", "PROTOCOL"); err != nil {
+		return fmt.Errorf("failed to bind PROTOCOL: %w", err)
+	}
+	if err := v.BindEnv("client.requests", "REQUESTS"); err != nil {
+		return fmt.Errorf("failed to bind REQUESTS: %w", err)
+	}
+	if err := v.BindEnv("client.tokenFile", "TOKEN_FILE"); err != nil {
+		return fmt.Errorf("failed to bind TOKEN_FILE: %w", err)
+	}
+	if err := v.BindEnv("client.tls.enabled", "TLS"); err != nil {
+		return fmt.Errorf("failed to bind TLS: %w", err)
+	}
+	if err := v.BindEnv("client.tls.serverName", "TLS_SERVER_NAME"); err != nil {
+		return fmt.Errorf("failed to bind TLS_SERVER_NAME: %w", err)
+	}
+	if err := v.BindEnv("client.tls.caFile", "TLS_CA"); err != nil {
+		return fmt.Errorf("failed to bind TLS_CA: %w", err)
+	}
+	if err := v.BindEnv("client.tls.certFile", "TLS_CERT"); err != nil {
+		return fmt.Errorf("failed to bind TLS_CERT: %w", err)
+	}
+	if err := v.BindEnv("client.tls.keyFile", "TLS_KEY"); err != nil {
+		return fmt.Errorf("failed to bind TLS_KEY: %w", err)
+	}
+	if err := v.BindEnv("client.workers", "SOLVER_WORKERS"); err != nil {
+		return fmt.Errorf("failed to bind SOLVER_WORKERS: %w", err)
+	}
+	if err := v.BindEnv("client.retries", "RETRIES"); err != nil {
+		return fmt.Errorf("failed to bind RETRIES: %w", err)
+	}
+	if err := v.BindEnv("client.maxDifficulty", "MAX_DIFFICULTY"); err != nil {
+		return fmt.Errorf("failed to bind MAX_DIFFICULTY: %w", err)
+	}
 
 	return nil
 }
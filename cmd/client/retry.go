@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/pkg/log"
+)
+
+const (
+	retryAfterPrefix   = "X-Retry-After:"
+	serviceUnavailable = "Service Unavailable"
+
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// overloadedError is returned when the server turned the client away or
+// only offered a challenge harder than it is willing to solve.
+type overloadedError struct {
+	// after is the server's retry hint, zero if it sent none.
+	after  time.Duration
+	reason string
+}
+
+func (e *overloadedError) Error() string {
+	if e.after > 0 {
+		return fmt.Sprintf("server overloaded: %s, retry after %s", e.reason, e.after)
+	}
+	return "server overloaded: " + e.reason
+}
+
+// quoteFunc gets a quote from the server.
+type quoteFunc func(ctx context.Context, cfg *Config) (string, error)
+
+// withRetries runs fn and retries it up to cfg.Client.Retries times while
+// the server is overloaded, backing off exponentially with jitter but never
+// sooner than the server asked.
+func withRetries(ctx context.Context, cfg *Config, fn quoteFunc) (string, error) {
+	for attempt := 0; ; attempt++ {
+		quote, err := fn(ctx, cfg)
+
+		var oe *overloadedError
+		if err == nil || !errors.As(err, &oe) || attempt >= cfg.Client.Retries {
+			return quote, err
+		}
+
+		delay := max(backoff(attempt), oe.after)
+		log.Warnf("%v, retrying in %s", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before retry attempt+1: the base delay doubled
+// per attempt, of which a random half is taken off so that clients turned
+// away together do not come back together.
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 16 {
+		d = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseRetryAfter parses the value of an X-Retry-After line, in seconds.
+func parseRetryAfter(msg string) time.Duration {
+	secs, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(msg, retryAfterPrefix)))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// challengeDifficulty returns the difficulty of a hashcash challenge, or 0
+// if it cannot be parsed.
+func challengeDifficulty(challenge string) int {
+	var c hashcash.Challenge
+	if err := c.FromString(challenge); err != nil {
+		return 0
+	}
+	return c.Difficulty
+}
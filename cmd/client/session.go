@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"wise-tcp/internal/proto"
+	"wise-tcp/pkg/log"
+)
+
+// withMoreQuotes fetches the rest of cfg.Client.Requests quotes over the
+// session opened by the first request, solving a new challenge whenever the
+// server asks for one. codec is nil for the text protocol.
+func withMoreQuotes(ctx context.Context, cfg *Config, conn net.Conn, codec *proto.Codec, first string) (string, error) {
+	quotes := []string{first}
+	for len(quotes) < cfg.Client.Requests {
+		var quote string
+		var err error
+		if codec != nil {
+			quote, err = requestQuoteBinary(ctx, cfg, conn, codec)
+		} else {
+			quote, err = requestQuoteText(ctx, cfg, conn)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get quote %d: %w", len(quotes)+1, err)
+		}
+		quotes = append(quotes, quote)
+	}
+	return strings.Join(quotes, "\n"), nil
+}
+
+func requestQuoteText(ctx context.Context, cfg *Config, conn net.Conn) (string, error) {
+	if err := sendMessage(conn, []byte("X-Request: quote\n")); err != nil {
+		return "", err
+	}
+	msg, err := receiveMessage(conn)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(msg, "X-Challenge:") {
+		challenge := strings.TrimSpace(strings.TrimPrefix(msg, "X-Challenge:"))
+		log.Debugf("Session credit used up, received challenge: %s", challenge)
+
+		solution, err := newSolver(cfg).SolveContext(ctx, challenge)
+		if err != nil {
+			return "", fmt.Errorf("failed to solve challenge: %w", err)
+		}
+		if err = sendMessage(conn, []byte("X-Response: "+solution+"\n")); err != nil {
+			return "", err
+		}
+		return receiveQuote(cfg, conn)
+	}
+
+	if strings.HasPrefix(msg, "X-Err:") {
+		return "", errors.New(strings.TrimSpace(strings.TrimPrefix(msg, "X-Err:")))
+	}
+	return msg, nil
+}
+
+func requestQuoteBinary(ctx context.Context, cfg *Config, conn net.Conn, codec *proto.Codec) (string, error) {
+	if err := conn.SetDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		return "", err
+	}
+	if err := codec.Write(proto.MsgRequest, []byte("quote")); err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+
+	m, err := codec.ReadMessage()
+	if err != nil {
+		return "", fmt.Errorf("failed to read reply: %w", err)
+	}
+
+	switch m.Type {
+	case proto.MsgData:
+		return strings.TrimSpace(string(m.Payload)), nil
+	case proto.MsgError:
+		return "", &proto.RemoteError{Msg: string(m.Payload)}
+	case proto.MsgChallenge:
+		log.Debugf("Session credit used up, received challenge: %s", m.Payload)
+		solution, err := newSolver(cfg).SolveContext(ctx, string(m.Payload))
+		if err != nil {
+			return "", fmt.Errorf("failed to solve challenge: %w", err)
+		}
+		return sendBinary(cfg, conn, codec, proto.MsgResponse, solution)
+	default:
+		return "", fmt.Errorf("%w: %s", proto.ErrUnexpectedType, m.Type)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"wise-tcp/pkg/log"
+)
+
+// loadToken returns the bearer token saved by an earlier run, if any.
+func loadToken(cfg *Config) string {
+	if cfg.Client.TokenFile == "" {
+		return ""
+	}
+	b, err := os.ReadFile(cfg.Client.TokenFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Failed to read token: %v", err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func saveToken(cfg *Config, token string) {
+	log.Debugf("Received token: %s", token)
+	if cfg.Client.TokenFile == "" {
+		return
+	}
+	if err := os.WriteFile(cfg.Client.TokenFile, []byte(token+"\n"), 0o600); err != nil {
+		log.Warnf("Failed to save token: %v", err)
+	}
+}
+
+// dropToken forgets a token the server rejected, so the next run solves a
+// challenge instead.
+func dropToken(cfg *Config) {
+	if cfg.Client.TokenFile == "" {
+		return
+	}
+	if err := os.Remove(cfg.Client.TokenFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("Failed to remove token: %v", err)
+	}
+}
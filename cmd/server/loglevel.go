@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"wise-tcp/pkg/log"
+)
+
+// watchLogLevels reloads the log levels from the config file on every
+// SIGHUP. The rest of the config is left as it is.
+func watchLogLevels(ctx context.Context) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP)
+	defer signal.Stop(sigc)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigc:
+			cfg, err := loadConfig()
+			if err == nil {
+				err = applyLogLevels(cfg.App)
+			}
+			if err != nil {
+				log.Errorf("Failed to reload log levels, keeping the current ones: %v", err)
+				continue
+			}
+			level, components := log.DefaultLevels().Get()
+			log.Infow("Log levels reloaded", "level", level, "components", components)
+		}
+	}
+}
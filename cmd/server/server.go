@@ -6,12 +6,16 @@ import (
 
 	"github.com/spf13/viper"
 
+	"wise-tcp/internal/admin"
 	"wise-tcp/internal/handler"
 	"wise-tcp/internal/pow"
 	"wise-tcp/internal/server"
+	"wise-tcp/internal/token"
 	"wise-tcp/pkg/config"
 	"wise-tcp/pkg/core"
+	"wise-tcp/pkg/handoff"
 	"wise-tcp/pkg/log"
+	"wise-tcp/pkg/slog"
 	"wise-tcp/pkg/zap"
 )
 
@@ -19,12 +23,26 @@ type Config struct {
 	App    AppConfig     `yaml:"app"`
 	Server server.Config `yaml:"server"`
 	//Guard  pow.GuardConfig `yaml:"guard"`
-	Pow pow.Config `yaml:"pow"`
+	Pow   pow.Config   `yaml:"pow"`
+	Token token.Config `yaml:"token"`
+	Admin admin.Config `yaml:"admin"`
 }
 
 type AppConfig struct {
 	Name string `yaml:"name"`
 	Prod bool   `yaml:"isProd"`
+	// Logger is the logging backend: zap (the default) or slog.
+	Logger string `yaml:"logger" env:"LOGGER"`
+	// Level is the lowest level logged; empty means debug in development
+	// and info in production.
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Levels override Level for named components and their children.
+	Levels []ComponentLevel `yaml:"levels"`
+}
+
+type ComponentLevel struct {
+	Component string `yaml:"component"`
+	Level     string `yaml:"level"`
 }
 
 func main() {
@@ -34,18 +52,42 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	go watchLogLevels(ctx)
+
 	log.Info("Initializing application...")
 
 	app := core.NewApp()
-	err := app.BuildUnits(
+
+	var units []core.UnitBuilder
+	if cfg.Pow.Adaptive.Enabled {
+		units = append(units, core.UnitBuilder{Builder: pow.DifficultyBuilder(cfg.Pow), Name: "pow.difficulty"})
+	}
+	if cfg.Token.Enabled {
+		units = append(units, core.UnitBuilder{Builder: token.Builder(cfg.Token, cfg.Pow.RedisAddr), Name: "token.auth"})
+	}
+	units = append(units,
 		core.UnitBuilder{Builder: pow.AuthBuilder(cfg.Pow), Name: "server.auth"},
 		core.UnitBuilder{Builder: handler.Builder(), Name: "server.handler"},
 		core.UnitBuilder{Builder: server.Builder(cfg.Server), Name: "server"},
 	)
+	if cfg.Admin.Enabled {
+		units = append(units, core.UnitBuilder{Builder: admin.Builder(cfg.Admin), Name: "admin"})
+	}
+
+	err := app.BuildUnits(units...)
 	if err != nil {
 		log.Fatalf("Failed to build app: %v", err)
 	}
 
+	// Lets the parent process drain, if this process was started by a
+	// graceful restart. Every unit has to be serving by then, not only the
+	// TCP listeners.
+	app.OnRunning(func() {
+		if err := handoff.Ready(); err != nil {
+			log.Errorf("Failed to report readiness: %v", err)
+		}
+	})
+
 	if err = app.Go(ctx); err != nil {
 		log.Fatal(err)
 	}
@@ -53,31 +95,109 @@ func main() {
 	log.Infof("Application finished with state %s", app.State())
 }
 
+const configPath = "cfg/server.yml"
+
 func mustLoadConfig() *Config {
-	return config.MustLoad[Config]("cfg/server.yml",
+	return config.MustLoad[Config](configPath,
 		config.WithEnvMapper[Config](applyConfigMapping))
 }
 
+func loadConfig() (*Config, error) {
+	return config.NewYamlLoader[Config](config.WithEnvMapper[Config](applyConfigMapping)).Load(configPath)
+}
+
 func initLogger(cfg AppConfig) {
-	logger, err := zap.New(
-		zap.WithName(cfg.Name),
-		zap.WithProd(cfg.Prod),
-	)
+	if err := applyLogLevels(cfg); err != nil {
+		log.Errorf("Failed to set log levels: %v", err)
+	}
+
+	var logger log.Logger
+	var err error
+	switch cfg.Logger {
+	case "", "zap":
+		logger, err = zap.New(zap.WithName(cfg.Name), zap.WithProd(cfg.Prod))
+	case "slog":
+		logger, err = slog.New(slog.WithName(cfg.Name), slog.WithJSON(cfg.Prod))
+	default:
+		err = fmt.Errorf("unknown logger %q", cfg.Logger)
+	}
 	if err != nil {
-		log.Errorf("Failed to initialize zap logger: %v", err)
+		log.Errorf("Failed to initialize logger: %v", err)
 		return
 	}
 
 	log.SetLogger(logger)
 }
 
+// applyLogLevels replaces the default log levels with those of cfg.
+func applyLogLevels(cfg AppConfig) error {
+	def := log.LevelDebug
+	if cfg.Prod {
+		def = log.LevelInfo
+	}
+	if cfg.Level != "" {
+		var err error
+		if def, err = log.ParseLevel(cfg.Level); err != nil {
+			return err
+		}
+	}
+
+	components := make(map[string]log.Level, len(cfg.Levels))
+	for _, c := range cfg.Levels {
+		level, err := log.ParseLevel(c.Level)
+		if err != nil {
+			return fmt.Errorf("component %s: %w", c.Component, err)
+		}
+		components[c.Component] = level
+	}
+
+	log.DefaultLevels().Set(def, components)
+	return nil
+}
+
 func applyConfigMapping(v *viper.Viper) error {
+	if err := v.BindEnv("app.logger", "LOGGER"); err != nil {
+		return fmt.Errorf("failed to bind LOGGER: %w", err)
+	}
+	if err := v.BindEnv("app.level", "LOG_LEVEL"); err != nil {
+		return fmt.Errorf("failed to bind LOG_LEVEL: %w", err)
+	}
 	if err := v.BindEnv("server.port", "PORT"); err != nil {
 		return fmt.Errorf("failed to bind PORT: %w", err)
 	}
+	if err := v.BindEnv("server.protocol", "PROTOCOL"); err != nil {
+		return fmt.Errorf("failed to bind PROTOCOL: %w", err)
+	}
+	if err := v.BindEnv("server.tls.enabled", "TLS"); err != nil {
+		return fmt.Errorf("failed to bind TLS: %w", err)
+	}
+	if err := v.BindEnv("server.tls.cert", "TLS_CERT"); err != nil {
+		return fmt.Errorf("failed to bind TLS_CERT: %w", err)
+	}
+	if err := v.BindEnv("server.tls.key", "TLS_KEY"); err != nil {
+		return fmt.Errorf("failed to bind TLS_KEY: %w", err)
+	}
+	if err := v.BindEnv("server.proxyProtocol.enabled", "PROXY_PROTOCOL"); err != nil {
+		return fmt.Errorf("failed to bind PROXY_PROTOCOL: %w", err)
+	}
+	if err := v.BindEnv("server.restart.enabled", "GRACEFUL_RESTART"); err != nil {
+		return fmt.Errorf("failed to bind GRACEFUL_RESTART: %w", err)
+	}
+	if err := v.BindEnv("server.session.enabled", "SESSION"); err != nil {
+		return fmt.Errorf("failed to bind SESSION: %w", err)
+	}
 	if err := v.BindEnv("server.throttle.max", "MAX_CONN"); err != nil {
 		return fmt.Errorf("failed to bind MAX_CONN: %w", err)
 	}
+	if err := v.BindEnv("server.throttle.perIP", "MAX_CONN_PER_IP"); err != nil {
+		return fmt.Errorf("failed to bind MAX_CONN_PER_IP: %w", err)
+	}
+	if err := v.BindEnv("server.throttle.overload.enabled", "OVERLOAD"); err != nil {
+		return fmt.Errorf("failed to bind OVERLOAD: %w", err)
+	}
+	if err := v.BindEnv("server.deadlines.minRate", "MIN_BYTE_RATE"); err != nil {
+		return fmt.Errorf("failed to bind MIN_BYTE_RATE: %w", err)
+	}
 	if err := v.BindEnv("pow.diff", "POW_DIFFICULTY"); err != nil {
 		return fmt.Errorf("failed to bind POW_DIFFICULTY: %w", err)
 	}
@@ -87,6 +207,24 @@ func applyConfigMapping(v *viper.Viper) error {
 	if err := v.BindEnv("pow.redis", "REDIS_ADDR"); err != nil {
 		return fmt.Errorf("failed to bind REDIS_ADDR: %w", err)
 	}
+	if err := v.BindEnv("pow.adaptive.enabled", "POW_ADAPTIVE"); err != nil {
+		return fmt.Errorf("failed to bind POW_ADAPTIVE: %w", err)
+	}
+	if err := v.BindEnv("pow.binding", "POW_BINDING"); err != nil {
+		return fmt.Errorf("failed to bind POW_BINDING: %w", err)
+	}
+	if err := v.BindEnv("pow.alg", "POW_ALG"); err != nil {
+		return fmt.Errorf("failed to bind POW_ALG: %w", err)
+	}
+	if err := v.BindEnv("token.enabled", "TOKEN_ENABLED"); err != nil {
+		return fmt.Errorf("failed to bind TOKEN_ENABLED: %w", err)
+	}
+	if err := v.BindEnv("admin.enabled", "ADMIN_ENABLED"); err != nil {
+		return fmt.Errorf("failed to bind ADMIN_ENABLED: %w", err)
+	}
+	if err := v.BindEnv("admin.addr", "ADMIN_ADDR"); err != nil {
+		return fmt.Errorf("failed to bind ADMIN_ADDR: %w", err)
+	}
 
 	return nil
 }
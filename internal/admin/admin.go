@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"wise-tcp/pkg/core"
+	"wise-tcp/pkg/core/build"
+	"wise-tcp/pkg/handoff"
+	"wise-tcp/pkg/log"
+	"wise-tcp/pkg/metrics"
+)
+
+// Config enables the admin HTTP server, which serves operational endpoints:
+// /metrics, /healthz, /readyz and /loglevel. It should not be exposed to
+// clients.
+type Config struct {
+	Enabled bool   `mapstructure:"enabled" env:"ADMIN_ENABLED"`
+	Addr    string `mapstructure:"addr" env:"ADMIN_ADDR"`
+}
+
+const (
+	defaultAddr       = "127.0.0.1:9090"
+	readHeaderTimeout = 5 * time.Second
+	healthTimeout     = 2 * time.Second
+	maxRequestSize    = 1 << 10
+)
+
+// HealthReporter reports the readiness of the app and its units.
+type HealthReporter interface {
+	Health(ctx context.Context) core.Health
+}
+
+func (c Config) Name() string {
+	return "admin"
+}
+
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+	srv *http.Server
+	ln  net.Listener
+}
+
+func Builder(cfg Config) build.Builder {
+	return func(i *build.Injector) (any, error) {
+		if cfg.Addr == "" {
+			cfg.Addr = defaultAddr
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Default())
+		mux.HandleFunc("GET /healthz", serveHealthz)
+		mux.Handle("GET /loglevel", getLevelsHandler(log.DefaultLevels()))
+		mux.Handle("PUT /loglevel", setLevelHandler(log.DefaultLevels()))
+
+		app, ok, err := build.ExtractOptional[HealthReporter](i, core.AppName)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			mux.Handle("GET /readyz", readyzHandler(app))
+		}
+
+		return &Server{
+			cfg: cfg,
+			mux: mux,
+			srv: &http.Server{Handler: mux, ReadHeaderTimeout: readHeaderTimeout},
+		}, nil
+	}
+}
+
+// serveHealthz reports the process alive whenever it gets to answer.
+func serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler reports the readiness of app per unit, with status 503
+// while it is not ready.
+func readyzHandler(app HealthReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+
+		h := app.Health(ctx)
+		status := http.StatusOK
+		if !h.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, h)
+	})
+}
+
+// levelsResponse reports the default log level and the component
+// overrides.
+type levelsResponse struct {
+	Level      log.Level            `json:"level"`
+	Components map[string]log.Level `json:"components"`
+}
+
+// levelRequest changes the level of Component, or the default level if it
+// is empty. An empty Level removes the override of Component.
+type levelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+func getLevelsHandler(levels *log.Levels) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeLevels(w, levels)
+	})
+}
+
+func setLevelHandler(levels *log.Levels) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req levelRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if req.Level == "" && req.Component != "" {
+			levels.UnsetComponentLevel(req.Component)
+			log.Infow("Log level override removed", "component", req.Component)
+			writeLevels(w, levels)
+			return
+		}
+
+		level, err := log.ParseLevel(req.Level)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if req.Component == "" {
+			levels.SetLevel(level)
+		} else {
+			levels.SetComponentLevel(req.Component, level)
+		}
+		log.Infow("Log level changed", "component", req.Component, "level", level)
+		writeLevels(w, levels)
+	})
+}
+
+func writeLevels(w http.ResponseWriter, levels *log.Levels) {
+	def, components := levels.Get()
+	if components == nil {
+		components = map[string]log.Level{}
+	}
+	writeJSON(w, http.StatusOK, levelsResponse{Level: def, Components: components})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Failed to write admin response: %v", err)
+	}
+}
+
+func (s *Server) Start(_ context.Context) error {
+	// Taken over on a graceful restart like the server listeners, so that
+	// the new process does not have to bind the address the old one holds.
+	ln, inherited, err := handoff.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start admin server: %w", err)
+	}
+	s.ln = ln
+	if inherited {
+		log.Infof("Inherited admin listener %s from the previous process", ln.Addr())
+	}
+	log.Infof("Admin server listening on %s", ln.Addr())
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Admin server failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	handoff.Unregister(handoff.Name("tcp", s.cfg.Addr))
+	return s.srv.Shutdown(ctx)
+}
+
+// Addr returns the address the server listens on, once started.
+func (s *Server) Addr() string {
+	if s.ln == nil {
+		return s.cfg.Addr
+	}
+	return s.ln.Addr().String()
+}
+
+func (s *Server) String() string {
+	return fmt.Sprintf("AdminServer on %s", s.Addr())
+}
@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"wise-tcp/pkg/core"
+	"wise-tcp/pkg/core/build"
+	"wise-tcp/pkg/handoff"
+	"wise-tcp/pkg/log"
+	"wise-tcp/pkg/metrics"
+)
+
+type fakeApp struct {
+	health core.Health
+}
+
+func (a *fakeApp) Health(_ context.Context) core.Health {
+	return a.health
+}
+
+func newTestServer(t *testing.T, app HealthReporter) *Server {
+	t.Helper()
+	i := build.NewInjector()
+	if app != nil {
+		i.Register(app, core.AppName)
+	}
+	item, err := Builder(Config{Enabled: true, Addr: "127.0.0.1:0"})(i)
+	if err != nil {
+		t.Fatalf("Failed to build admin server: %v", err)
+	}
+	s := item.(*Server)
+	if err = s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start admin server: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Stop(context.Background()) })
+	return s
+}
+
+func get(t *testing.T, s *Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get("http://" + s.Addr() + path)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	metrics.NewCounter("admin_test_total", "Test counter.").Inc()
+	s := newTestServer(t, nil)
+
+	code, body := get(t, s, "/metrics")
+	if code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if !strings.Contains(body, "admin_test_total 1\n") {
+		t.Errorf("Expected test counter in metrics, got %q", body)
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	app := &fakeApp{health: core.Health{
+		State: "Running",
+		Units: []core.UnitHealth{
+			{Name: "server", State: "Running", Ready: true},
+			{Name: "server.auth", State: "Running", Error: "redis down"},
+		},
+	}}
+	s := newTestServer(t, app)
+
+	if code, _ := get(t, s, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected healthz status 200, got %d", code)
+	}
+
+	code, body := get(t, s, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readyz status 503, got %d", code)
+	}
+	var h core.Health
+	if err := json.Unmarshal([]byte(body), &h); err != nil {
+		t.Fatalf("Failed to decode readyz: %v", err)
+	}
+	if len(h.Units) != 2 || h.Units[1].Error != "redis down" {
+		t.Errorf("Expected per unit status, got %s", body)
+	}
+
+	app.health.Ready = true
+	if code, _ = get(t, s, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected readyz status 200, got %d", code)
+	}
+}
+
+func put(t *testing.T, s *Server, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, "http://"+s.Addr()+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to put %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestServer_LogLevel(t *testing.T) {
+	levels := log.DefaultLevels()
+	def, components := levels.Get()
+	t.Cleanup(func() { levels.Set(def, components) })
+	levels.Set(log.LevelInfo, nil)
+	s := newTestServer(t, nil)
+
+	if code, body := put(t, s, "/loglevel", `{"component":"server","level":"debug"}`); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, body)
+	}
+	if code, _ := put(t, s, "/loglevel", `{"level":"warn"}`); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if code, _ := put(t, s, "/loglevel", `{"level":"verbose"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown level, got %d", code)
+	}
+
+	_, body := get(t, s, "/loglevel")
+	want := `{"level":"warn","components":{"server":"debug"}}` + "\n"
+	if body != want {
+		t.Errorf("Expected %s, got %s", want, body)
+	}
+	if !levels.Enabled("server.pow", log.LevelDebug) {
+		t.Error("Expected debug to be enabled below server")
+	}
+
+	put(t, s, "/loglevel", `{"component":"server"}`)
+	if levels.Enabled("server", log.LevelInfo) {
+		t.Error("Expected server to fall back to the default level")
+	}
+}
+
+func TestServer_HandsOffListener(t *testing.T) {
+	s := newTestServer(t, nil)
+	name := handoff.Name("tcp", s.cfg.Addr)
+
+	files, err := handoff.Registered()
+	if err != nil {
+		t.Fatalf("Failed to get registered sockets: %v", err)
+	}
+	if _, ok := files[name]; !ok {
+		t.Errorf("Expected admin listener to be registered for handoff, got %v", files)
+	}
+
+	if err = s.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if files, _ = handoff.Registered(); files[name] != nil {
+		t.Error("Expected admin listener to be unregistered on stop")
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
+
+	"wise-tcp/internal/proto"
 )
 
 type RequestAuthorizer interface {
@@ -17,4 +20,44 @@ var (
 
 type Request struct {
 	ClientAddr string
+	// Codec is set when the connection uses the binary framing protocol.
+	Codec *proto.Codec
+	// Lines reads the text protocol lines of the connection. Authorizers
+	// read through it, so that what it buffered past a line is not lost;
+	// if it is nil, they read through a reader of their own.
+	Lines *proto.LineReader
+	// Renewal is set when a session has used up its credit and the client
+	// is authorized again on the same connection.
+	Renewal bool
+	// Token is a bearer token the client presented in place of a proof of
+	// work.
+	Token string
+	// Overload is set when the server has no free connection slot but lets
+	// the client pay its way in with a harder challenge.
+	Overload *Overload
+}
+
+// Overload describes the terms for a client admitted while the server is
+// overloaded.
+type Overload struct {
+	// ExtraBits is added to the challenge difficulty.
+	ExtraBits int
+	// RetryAfter is the hint for clients that would rather come back
+	// later than solve the harder challenge.
+	RetryAfter time.Duration
+}
+
+// ChallengeNotifier is implemented by connections that apply separate
+// deadlines to the phases of a request; a sent challenge starts the window
+// for solving it.
+type ChallengeNotifier interface {
+	ChallengeSent()
+}
+
+// ChallengeSent tells rw that a challenge has been written to it, if rw
+// wants to know.
+func ChallengeSent(rw io.Writer) {
+	if n, ok := rw.(ChallengeNotifier); ok {
+		n.ChallengeSent()
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -48,10 +49,23 @@ func (q *Quote) Init(ctx context.Context) error {
 	return nil
 }
 
+// CheckHealth fails if there are no quotes to serve. Quotes are fetched
+// from ZenQuotes online only when none could be loaded, so being unable to
+// reach it is not a failure by itself.
+func (q *Quote) CheckHealth(_ context.Context) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if len(q.quoteDB) == 0 {
+		return errors.New("no quotes loaded")
+	}
+	return nil
+}
+
 func (q *Quote) Handle(ctx context.Context, rw io.ReadWriter) error {
 	quote, err := q.getQuote(ctx)
 	if err != nil {
-		log.Error(err)
+		log.FromContext(ctx).Error(err)
 		return fmt.Errorf("failed to fetch quote: %w", err)
 	}
 
@@ -74,33 +88,33 @@ func (q *Quote) loadZenQuotes(ctx context.Context) {
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, quotesBatchURL, nil)
 	if err != nil {
-		log.Error("Failed to create request:", err)
+		log.Errorw("Failed to create request", "error", err)
 		q.quoteDB = q.fallbackQuotes()
 		return
 	}
 
 	resp, err := q.client.Do(req)
 	if err != nil {
-		log.Error("Failed to fetch quotes:", err)
+		log.Errorw("Failed to fetch quotes", "error", err)
 		q.quoteDB = q.fallbackQuotes()
 		return
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Error("Failed to close response body:", err)
+			log.Errorw("Failed to close response body", "error", err)
 		}
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		log.Error("Non-OK HTTP status:", resp.StatusCode)
+		log.Errorw("Non-OK HTTP status", "status", resp.StatusCode)
 		q.quoteDB = q.fallbackQuotes()
 		return
 	}
 
 	var quotes []zenQuote
 	if err = json.NewDecoder(resp.Body).Decode(&quotes); err != nil {
-		log.Error("Failed to decode quotes:", err)
+		log.Errorw("Failed to decode quotes", "error", err)
 		q.quoteDB = q.fallbackQuotes()
 		return
 	}
@@ -156,7 +170,7 @@ func (q *Quote) randomZenOnline(ctx context.Context) (string, error) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Error("Failed to close response body:", err)
+			log.Errorw("Failed to close response body", "error", err)
 		}
 	}(resp.Body)
 
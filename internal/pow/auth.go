@@ -1,46 +1,218 @@
 package pow
 
 import (
-	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 	"time"
 
 	"wise-tcp/internal/auth"
 	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/internal/proto"
 	"wise-tcp/pkg/core"
 	"wise-tcp/pkg/core/build"
 	"wise-tcp/pkg/log"
 )
 
+// logComponent names the logger of challenges, below the logger of the
+// connection they are issued on.
+const logComponent = "pow"
+
 type Auth struct {
-	provider Provider
-	async    bool
+	provider   Provider
+	async      bool
+	difficulty *DifficultyController
+	reputation *Reputation
+	maxLine    int
+	tokens     TokenIssuer
+}
+
+type AuthOption func(*Auth)
+
+// WithDifficultyController makes Auth issue challenges at the difficulty
+// chosen by c and report verification outcomes to it.
+func WithDifficultyController(c *DifficultyController) AuthOption {
+	return func(a *Auth) {
+		a.difficulty = c
+	}
+}
+
+// WithReputation makes Auth record client behavior in r and charge extra
+// difficulty bits to clients with a bad reputation.
+func WithReputation(r *Reputation) AuthOption {
+	return func(a *Auth) {
+		a.reputation = r
+	}
+}
+
+// WithMaxLineLength limits the length of a text protocol response line;
+// longer lines are rejected as a protocol mismatch.
+func WithMaxLineLength(n int) AuthOption {
+	return func(a *Auth) {
+		a.maxLine = n
+	}
+}
+
+// WithTokens makes Auth hand out a bearer token after each solved
+// challenge and accept tokens in place of a solution.
+func WithTokens(t TokenIssuer) AuthOption {
+	return func(a *Auth) {
+		a.tokens = t
+	}
 }
 
 func AuthBuilder(cfg Config) build.Builder {
-	return func(_ *build.Injector) (any, error) {
-		opts := []hashcash.ProviderOption{
-			hashcash.WithDifficulty(cfg.Difficulty),
+	return func(i *build.Injector) (any, error) {
+		provider, err := NewProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		authOpts := []AuthOption{WithMaxLineLength(cfg.MaxLineLength)}
+		dc, ok, err := build.ExtractOptional[*DifficultyController](i, "pow.difficulty")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			authOpts = append(authOpts, WithDifficultyController(dc))
+		}
+
+		tokens, ok, err := build.ExtractOptional[TokenIssuer](i, "token.auth")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			authOpts = append(authOpts, WithTokens(tokens))
+		}
+
+		if cfg.Reputation.Enabled {
+			store, err := newReputationStore(cfg)
+			if err != nil {
+				return nil, err
+			}
+			authOpts = append(authOpts, WithReputation(NewReputation(store, cfg.Reputation)))
+		}
+
+		a := NewAuth(provider, cfg.AsyncMode, authOpts...)
+		registerGauges(a)
+		return a, nil
+	}
+}
+
+// NewProvider builds the hashcash provider described by cfg. The beacon
+// builds its provider the same way, so that the server accepts the
+// challenges it issues.
+func NewProvider(cfg Config) (*hashcash.Provider, error) {
+	opts := []hashcash.ProviderOption{
+		hashcash.WithDifficulty(cfg.Difficulty),
+	}
+	if cfg.Algorithm != "" {
+		if err := hashcash.ValidateAlgorithm(cfg.Algorithm); err != nil {
+			return nil, err
+		}
+		opts = append(opts, hashcash.WithAlgorithm(cfg.Algorithm))
+	}
+	if len(cfg.AllowedAlgs) > 0 {
+		for _, alg := range cfg.AllowedAlgs {
+			if err := hashcash.ValidateAlgorithm(alg); err != nil {
+				return nil, err
+			}
 		}
-		if cfg.AsyncMode {
-			opts = append(opts, hashcash.WithCache(hashcash.NewRedisCache(cfg.RedisAddr)))
+		opts = append(opts, hashcash.WithAllowedAlgorithms(cfg.AllowedAlgs...))
+	}
+	if cfg.AsyncMode {
+		opts = append(opts, hashcash.WithCache(hashcash.NewRedisCache(cfg.RedisAddr)))
+	}
+	if cfg.Binding != "" {
+		binding, err := hashcash.ParseBinding(cfg.Binding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, hashcash.WithBinding(binding))
+	}
+	if cfg.Stateless.Enabled {
+		signer, err := newSigner(cfg.Stateless)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, hashcash.WithSigner(signer))
+	}
+	return hashcash.NewProvider(opts...), nil
+}
+
+func newSigner(cfg StatelessConfig) (*hashcash.Signer, error) {
+	keys := make(map[string][]byte, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		secret, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret for signing key %q: %w", k.ID, err)
 		}
-		provider := hashcash.NewProvider(opts...)
-		return NewAuth(provider, cfg.AsyncMode), nil
+		keys[k.ID] = secret
 	}
+
+	return hashcash.NewSigner(cfg.ActiveKey, keys)
 }
 
-func NewAuth(provider Provider, async bool) *Auth {
-	return &Auth{
+func NewAuth(provider Provider, async bool, opts ...AuthOption) *Auth {
+	a := &Auth{
 		provider: provider,
 		async:    async,
+		maxLine:  proto.DefaultMaxLine,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Difficulty returns the difficulty for newly issued challenges, or 0 when
+// the provider default applies.
+func (a *Auth) Difficulty() int {
+	if a.difficulty == nil {
+		return 0
+	}
+	return a.difficulty.Difficulty()
+}
+
+// subjectDifficulty returns the difficulty for a challenge issued to
+// subject, including extra bits and any reputation surcharge, but no more
+// than the provider supports.
+func (a *Auth) subjectDifficulty(subject string, extra int) int {
+	if a.reputation != nil {
+		extra += a.reputation.ExtraBits(subject)
+	}
+
+	difficulty := a.Difficulty()
+	if extra > 0 {
+		difficulty = a.baseDifficulty() + extra
 	}
+	if m, ok := a.provider.(interface{ MaxDifficulty() int }); ok {
+		difficulty = min(difficulty, m.MaxDifficulty())
+	}
+	return difficulty
+}
+
+// baseDifficulty is Difficulty with the provider default filled in.
+func (a *Auth) baseDifficulty() int {
+	if d := a.Difficulty(); d != 0 {
+		return d
+	}
+	if d, ok := a.provider.(interface{ Difficulty() int }); ok {
+		return d.Difficulty()
+	}
+	return 0
 }
 
 func (a *Auth) Start(ctx context.Context) error {
+	if a.reputation != nil {
+		if err := a.reputation.Start(ctx); err != nil {
+			return err
+		}
+	}
 	if starter, ok := a.provider.(core.Starter); ok {
 		return starter.Start(ctx)
 	}
@@ -48,65 +220,193 @@ func (a *Auth) Start(ctx context.Context) error {
 }
 
 func (a *Auth) Stop(ctx context.Context) error {
+	if a.reputation != nil {
+		if err := a.reputation.Stop(ctx); err != nil {
+			return err
+		}
+	}
 	if starter, ok := a.provider.(core.Stopper); ok {
 		return starter.Stop(ctx)
 	}
 	return nil
 }
 
+// CheckHealth checks the stores behind the provider and the reputation.
+func (a *Auth) CheckHealth(ctx context.Context) error {
+	items := []any{a.provider}
+	if a.reputation != nil {
+		items = append(items, a.reputation)
+	}
+	return core.CheckHealth(ctx, items...)
+}
+
 func (a *Auth) AuthorizeRequest(ctx context.Context, request auth.Request, rw io.ReadWriter) error {
-	if a.async {
-		return a.handleAsyncMode(ctx, rw)
+	ctx = log.NewContext(ctx, log.FromContext(ctx).Named(logComponent))
+
+	lines := request.Lines
+	if lines == nil && request.Codec == nil {
+		lines = proto.NewLineReader(rw, a.maxLine)
+	}
+
+	var err error
+	// A renewal always challenges inline: the client is already connected
+	// and waiting for the result of its request.
+	if request.Codec != nil {
+		err = a.handleBinary(ctx, request.ClientAddr, request.Codec, rw, request.Renewal)
+	} else if request.Overload != nil {
+		err = a.handleOverload(ctx, request, lines, rw)
+	} else if a.async && !request.Renewal {
+		err = a.handleAsyncMode(ctx, request.ClientAddr, lines, rw)
+	} else {
+		err = a.handleSyncMode(ctx, request.ClientAddr, lines, rw)
 	}
 
-	return a.handleSyncMode(ctx, request.ClientAddr, rw)
+	if a.reputation != nil {
+		if ev, ok := classify(err); ok {
+			a.reputation.Record(request.ClientAddr, ev)
+		}
+	}
+
+	return err
 }
 
-func (a *Auth) handleSyncMode(ctx context.Context, subject string, rw io.ReadWriter) error {
-	challenge, err := a.provider.Challenge(subject, 0)
+func (a *Auth) handleSyncMode(ctx context.Context, subject string, lines *proto.LineReader, rw io.ReadWriter) error {
+	difficulty := a.subjectDifficulty(subject, 0)
+	ctx = a.difficultyContext(ctx, difficulty)
+	challenge, err := a.newChallenge(ctx, subject, difficulty)
 	if err != nil {
-		return fmt.Errorf("failed to generate challenge: %w", err)
+		return err
 	}
 
 	if err := a.sendChallenge(ctx, rw, challenge); err != nil {
 		return err
 	}
 
-	response, err := a.readResponse(ctx, rw)
+	response, err := a.readResponse(ctx, lines, rw)
+	if err != nil {
+		return err
+	}
+
+	return a.handleResponse(ctx, subject, response, rw)
+}
+
+// handleOverload admits a client while the server is out of connection
+// slots. The client is told when to come back and gets a harder challenge
+// it may solve instead; tokens are not accepted, and an easier solution
+// the client sent up front does not count.
+func (a *Auth) handleOverload(ctx context.Context, req auth.Request, lines *proto.LineReader, rw io.Writer) error {
+	subject, ov := req.ClientAddr, req.Overload
+	difficulty := max(a.subjectDifficulty(subject, ov.ExtraBits), a.baseDifficulty())
+	ctx = a.difficultyContext(ctx, difficulty)
+	challenge, err := a.newChallenge(ctx, subject, difficulty)
+	if err != nil {
+		return err
+	}
+
+	retryAfter := int(math.Ceil(ov.RetryAfter.Seconds()))
+	if _, err = fmt.Fprintf(rw, "X-Retry-After: %d\n", retryAfter); err != nil {
+		return fmt.Errorf("failed to write retry hint: %w", err)
+	}
+	if err = a.sendChallenge(ctx, rw, challenge); err != nil {
+		return err
+	}
+
+	response, err := a.readResponse(ctx, lines, rw)
 	if err != nil {
 		return err
 	}
+	solution, ok := a.parseResponse(response)
+	if !ok {
+		return auth.ErrProtoMismatch
+	}
+
+	c, ok := a.provider.(responseChecker)
+	if ok && !c.Check(solution, subject, difficulty) {
+		if err = textRejecter(rw)("insufficient difficulty"); err != nil {
+			log.FromContext(ctx).Error(err)
+		}
+		return auth.ErrUnauthorized
+	}
+
+	return a.verifySolution(ctx, subject, solution, textRejecter(rw))
+}
+
+// handleResponse authorizes the client by the response line: a solution,
+// or a bearer token if tokens are enabled.
+func (a *Auth) handleResponse(ctx context.Context, subject, response string, rw io.ReadWriter) error {
+	if token, ok := strings.CutPrefix(response, "X-Token:"); ok && a.tokens != nil {
+		req := auth.Request{ClientAddr: subject, Token: strings.TrimSpace(token)}
+		return a.tokens.AuthorizeRequest(ctx, req, rw)
+	}
 
 	solution, ok := a.parseResponse(response)
 	if !ok {
 		return auth.ErrProtoMismatch
 	}
 
-	return a.verifySolution(ctx, solution, rw)
+	if err := a.verifySolution(ctx, subject, solution, textRejecter(rw)); err != nil {
+		return err
+	}
+
+	a.issueToken(ctx, subject, func(token string) error {
+		_, err := rw.Write([]byte("X-Token: " + token + "\n"))
+		return err
+	})
+	return nil
 }
 
-func (*Auth) parseResponse(response []byte) (string, bool) {
-	if !strings.HasPrefix(string(response), "X-Response:") {
+func (*Auth) parseResponse(response string) (string, bool) {
+	if !strings.HasPrefix(response, "X-Response:") {
 		return "", false
 	}
-	return strings.TrimSpace(strings.TrimPrefix(string(response), "X-Response:")), true
+	return strings.TrimSpace(strings.TrimPrefix(response, "X-Response:")), true
+}
+
+// ValidResponse reports whether line, the first line a client sent, holds
+// a solution that would pass verification. The server throttle uses it to
+// let clients that arrive with a solved challenge skip the queue; the
+// challenge is only spent by the real verification.
+func (a *Auth) ValidResponse(subject, line string) bool {
+	solution, ok := a.parseResponse(strings.TrimSpace(line))
+	if !ok {
+		return false
+	}
+	c, ok := a.provider.(responseChecker)
+	if !ok {
+		return false
+	}
+	return c.Check(solution, subject, a.baseDifficulty())
 }
 
-func (a *Auth) handleAsyncMode(ctx context.Context, rw io.ReadWriter) error {
+func (a *Auth) handleAsyncMode(ctx context.Context, subject string, lines *proto.LineReader, rw io.ReadWriter) error {
 	readCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	response, err := a.readResponse(readCtx, rw)
+	response, err := a.readResponse(readCtx, lines, rw)
 	if err != nil {
 		return err
 	}
 
-	solution, ok := a.parseResponse(response)
-	if !ok {
-		return auth.ErrProtoMismatch
+	return a.handleResponse(ctx, subject, response, rw)
+}
+
+func (a *Auth) newChallenge(ctx context.Context, subject string, difficulty int) (string, error) {
+	challenge, err := a.provider.Challenge(subject, difficulty)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
 	}
+	challengesIssued.Inc()
+	log.FromContext(ctx).Debug("Challenge issued")
+	return challenge, nil
+}
 
-	return a.verifySolution(ctx, solution, rw)
+// difficultyContext returns ctx with the difficulty of a challenge in its
+// log fields.
+func (a *Auth) difficultyContext(ctx context.Context, difficulty int) context.Context {
+	if difficulty == 0 {
+		difficulty = a.baseDifficulty()
+	}
+	return log.ContextWithFields(ctx, log.Fields{"difficulty": difficulty})
 }
 
 func (a *Auth) sendChallenge(ctx context.Context, rw io.Writer, challenge string) error {
@@ -117,6 +417,7 @@ func (a *Auth) sendChallenge(ctx context.Context, rw io.Writer, challenge string
 			if err != nil {
 				return fmt.Errorf("failed to write challenge: %w", err)
 			}
+			auth.ChallengeSent(rw)
 			return nil
 		}()
 	}()
@@ -129,36 +430,57 @@ func (a *Auth) sendChallenge(ctx context.Context, rw io.Writer, challenge string
 	}
 }
 
-func (a *Auth) readResponse(ctx context.Context, rw io.Reader) ([]byte, error) {
-	responseDone := make(chan error, 1)
-	response := make([]byte, 128)
+// readResponse reads the response line from lines, rejecting it on rw if
+// it is too long.
+func (a *Auth) readResponse(ctx context.Context, lines *proto.LineReader, rw io.Writer) (string, error) {
+	line, err := lines.ReadLineMax(ctx, a.maxLine)
+	if err != nil {
+		if errors.Is(err, proto.ErrLineTooLong) {
+			if werr := textRejecter(rw)("line too long"); werr != nil {
+				log.FromContext(ctx).Error(werr)
+			}
+			return "", fmt.Errorf("%w: %v", auth.ErrProtoMismatch, err)
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
 
-	var n int
-	go func() {
-		var err error
-		n, err = rw.Read(response)
-		responseDone <- err
-	}()
+	return strings.TrimSpace(line), nil
+}
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case err := <-responseDone:
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
+// issueToken sends a new bearer token to a client that solved its
+// challenge. Failing to issue one does not fail the authorization.
+func (a *Auth) issueToken(ctx context.Context, subject string, send func(token string) error) {
+	if a.tokens == nil {
+		return
+	}
+	token, err := a.tokens.Mint(subject)
+	if err == nil {
+		err = send(token)
 	}
+	if err != nil {
+		log.FromContext(ctx).Errorf("Failed to issue token: %v", err)
+	}
+}
 
-	return bytes.Trim(response[:n], " \n\x00"), nil
+func textRejecter(w io.Writer) func(reason string) error {
+	return func(reason string) error {
+		_, err := w.Write([]byte("X-Err: " + reason + "\n"))
+		return err
+	}
 }
 
-func (a *Auth) verifySolution(ctx context.Context, solution string, rw io.Writer) error {
+func (a *Auth) verifySolution(ctx context.Context, subject, solution string, reject func(reason string) error) error {
 	verifyDone := make(chan error, 1)
 	var valid bool
 
 	go func() {
+		start := time.Now()
 		var err error
-		valid, err = a.provider.Verify(solution)
+		valid, err = a.provider.VerifySubject(solution, subject)
+		verifySeconds.Observe(time.Since(start).Seconds())
 		verifyDone <- err
 	}()
 
@@ -166,15 +488,25 @@ func (a *Auth) verifySolution(ctx context.Context, solution string, rw io.Writer
 	case <-ctx.Done():
 		return ctx.Err()
 	case err := <-verifyDone:
+		if a.difficulty != nil {
+			a.difficulty.ObserveVerify(err == nil && valid)
+		}
+		if errors.Is(err, hashcash.ErrSubjectMismatch) {
+			// A challenge presented by another client is most likely
+			// stolen; it is not told why it was rejected.
+			if rerr := reject("invalid solution"); rerr != nil {
+				log.FromContext(ctx).Error(rerr)
+			}
+			return fmt.Errorf("%w: %w", auth.ErrUnauthorized, err)
+		}
 		if err != nil {
 			return fmt.Errorf("verification error: %w", err)
 		}
 	}
 
 	if !valid {
-		_, err := rw.Write([]byte("X-Err: invalid solution\n"))
-		if err != nil {
-			log.Error(err)
+		if err := reject("invalid solution"); err != nil {
+			log.FromContext(ctx).Error(err)
 		}
 		return auth.ErrUnauthorized
 	}
@@ -0,0 +1,262 @@
+package pow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/internal/proto"
+)
+
+func TestAuth_ValidResponse(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithDifficulty(8), hashcash.WithBinding(hashcash.BindIP))
+	a := NewAuth(provider, true)
+
+	challenge, err := provider.Challenge("192.0.2.1:5000", 8)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	solution, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	tests := []struct {
+		line string
+		addr string
+		want bool
+	}{
+		{"X-Response: " + solution + "\r", "192.0.2.1:6000", true},
+		{"X-Response: " + solution, "198.51.100.7:5000", false},
+		{"X-Token: abc", "192.0.2.1:6000", false},
+		{solution, "192.0.2.1:6000", false},
+	}
+	for _, tt := range tests {
+		if got := a.ValidResponse(tt.addr, tt.line); got != tt.want {
+			t.Errorf("ValidResponse(%q, %q): expected %v, got %v", tt.addr, tt.line, tt.want, got)
+		}
+	}
+
+	// A solution below the current difficulty does not jump the queue.
+	easy, err := provider.Challenge("192.0.2.1:5000", 4)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	if solution, err = hashcash.NewSolver().Solve(easy); err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	if a.ValidResponse("192.0.2.1:5000", "X-Response: "+solution) {
+		t.Error("Expected easier solution not to count")
+	}
+}
+
+func TestAuth_Overload(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithDifficulty(8))
+	a := NewAuth(provider, true)
+	ov := &auth.Overload{ExtraBits: 4, RetryAfter: 1500 * time.Millisecond}
+
+	tests := []struct {
+		name    string
+		solve   func(challenge string) (string, error)
+		wantErr error
+	}{
+		{"solved", hashcash.NewSolver().Solve, nil},
+		{"easier solution", func(string) (string, error) {
+			easy, err := provider.Challenge("client", 8)
+			if err != nil {
+				return "", err
+			}
+			return hashcash.NewSolver().Solve(easy)
+		}, auth.ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+
+			lines := make(chan string, 4)
+			go func() {
+				defer close(lines)
+				r := bufio.NewReader(client)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					lines <- line
+					if challenge, ok := strings.CutPrefix(line, "X-Challenge: "); ok {
+						solution, err := tt.solve(challenge)
+						if err != nil {
+							return
+						}
+						_, _ = client.Write([]byte("X-Response: " + solution + "\n"))
+					}
+				}
+			}()
+
+			req := auth.Request{ClientAddr: "client", Overload: ov}
+			err := a.AuthorizeRequest(context.Background(), req, server)
+			_ = server.Close()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+
+			var got []string
+			for line := range lines {
+				got = append(got, line)
+			}
+			if len(got) < 2 || got[0] != "X-Retry-After: 2" {
+				t.Fatalf("Expected retry hint before the challenge, got %q", got)
+			}
+			var c hashcash.Challenge
+			if err = c.FromString(strings.TrimPrefix(got[1], "X-Challenge: ")); err != nil {
+				t.Fatalf("Failed to parse challenge: %v", err)
+			}
+			if c.Difficulty != 12 {
+				t.Errorf("Expected difficulty 12, got %d", c.Difficulty)
+			}
+		})
+	}
+}
+
+func TestAuth_SubjectMismatch(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithDifficulty(8), hashcash.WithBinding(hashcash.BindIP))
+	a := NewAuth(provider, true)
+
+	// A challenge issued to one client is presented by another.
+	challenge, err := provider.Challenge("192.0.2.1:5000", 0)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	solution, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	var out bytes.Buffer
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader("X-Response: " + solution + "\n"), &out}
+	req := auth.Request{ClientAddr: "198.51.100.7:5000"}
+	err = a.AuthorizeRequest(context.Background(), req, rw)
+	if !errors.Is(err, auth.ErrUnauthorized) || !errors.Is(err, hashcash.ErrSubjectMismatch) {
+		t.Errorf("Expected unauthorized subject mismatch, got %v", err)
+	}
+	if got := out.String(); got != "X-Err: invalid solution\n" {
+		t.Errorf("Expected rejection line, got %q", got)
+	}
+}
+
+func TestAuth_SharedLineReader(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithDifficulty(8))
+	a := NewAuth(provider, false)
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		line, err := bufio.NewReader(client).ReadString('\n')
+		if err != nil {
+			return
+		}
+		solution, err := hashcash.NewSolver().Solve(strings.TrimSpace(strings.TrimPrefix(line, "X-Challenge: ")))
+		if err != nil {
+			return
+		}
+		// The first request arrives together with the response.
+		_, _ = client.Write([]byte("X-Response: " + solution + "\nX-Request: quote\n"))
+	}()
+
+	lines := proto.NewLineReader(server, 0)
+	req := auth.Request{ClientAddr: "192.0.2.1:5000", Lines: lines}
+	if err := a.AuthorizeRequest(context.Background(), req, server); err != nil {
+		t.Fatalf("Failed to authorize: %v", err)
+	}
+
+	got, err := lines.ReadLine(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to read request: %v", err)
+	}
+	if got != "X-Request: quote" {
+		t.Errorf("Expected %q, got %q", "X-Request: quote", got)
+	}
+}
+
+func TestNewProvider_Stateless(t *testing.T) {
+	cfg := Config{
+		Difficulty: 8,
+		Binding:    "ip",
+		Stateless: StatelessConfig{
+			Enabled:   true,
+			ActiveKey: "k1",
+			Keys:      []SigningKey{{ID: "k1", Secret: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))}},
+		},
+	}
+
+	// The beacon and the server build their providers from the same config,
+	// so a challenge from one verifies on the other.
+	beacon, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	server, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	raw, err := beacon.RawChallenge("192.0.2.1:5000", 0)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	if raw.Difficulty != cfg.Difficulty {
+		t.Errorf("Expected difficulty %d, got %d", cfg.Difficulty, raw.Difficulty)
+	}
+	response, err := hashcash.NewSolver().Solve(raw.String())
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	valid, err := server.VerifySubject(response, "192.0.2.1:6000")
+	if err != nil || !valid {
+		t.Errorf("Expected valid response, got %v, %v", valid, err)
+	}
+
+	// An unsigned challenge, as from a provider that ignores the config,
+	// is rejected.
+	unsigned, err := hashcash.NewProvider(hashcash.WithDifficulty(8)).Challenge("192.0.2.1:5000", 0)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	if response, err = hashcash.NewSolver().Solve(unsigned); err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	if valid, _ = server.VerifySubject(response, "192.0.2.1:6000"); valid {
+		t.Error("Expected unsigned challenge to be rejected")
+	}
+}
+
+func TestNewProvider_InvalidConfig(t *testing.T) {
+	tests := []Config{
+		{Algorithm: "md5"},
+		{AllowedAlgs: []string{"sha256", "md5"}},
+		{Binding: "port"},
+		{Stateless: StatelessConfig{Enabled: true, ActiveKey: "k1", Keys: []SigningKey{{ID: "k1", Secret: "!"}}}},
+	}
+	for _, cfg := range tests {
+		if _, err := NewProvider(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/proto"
+	"wise-tcp/pkg/log"
+)
+
+// handleBinary runs the handshake over the binary framing protocol. The
+// client opens with a hello frame, which the server answers with its own
+// hello; then the server sends a challenge (sync mode only) and expects a
+// response frame. A renewal skips the hello and is always challenged. rw is
+// the connection under codec.
+func (a *Auth) handleBinary(ctx context.Context, subject string, codec *proto.Codec, rw io.Writer, renewal bool) error {
+	if !renewal {
+		if _, err := a.readMessage(ctx, codec, proto.MsgHello); err != nil {
+			return err
+		}
+		if err := a.writeMessage(ctx, codec, proto.MsgHello, []byte(strconv.Itoa(proto.Version))); err != nil {
+			return err
+		}
+	}
+
+	readCtx := ctx
+	if a.async && !renewal {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, 1*time.Second)
+		defer cancel()
+	} else {
+		difficulty := a.subjectDifficulty(subject, 0)
+		ctx = a.difficultyContext(ctx, difficulty)
+		readCtx = ctx
+		challenge, err := a.newChallenge(ctx, subject, difficulty)
+		if err != nil {
+			return err
+		}
+		if err = a.writeMessage(ctx, codec, proto.MsgChallenge, []byte(challenge)); err != nil {
+			return err
+		}
+		auth.ChallengeSent(rw)
+	}
+
+	types := []proto.MessageType{proto.MsgResponse}
+	if a.tokens != nil {
+		types = append(types, proto.MsgToken)
+	}
+	m, err := a.readMessage(readCtx, codec, types...)
+	if err != nil {
+		return err
+	}
+
+	if m.Type == proto.MsgToken {
+		req := auth.Request{ClientAddr: subject, Codec: codec, Token: string(m.Payload)}
+		return a.tokens.AuthorizeRequest(ctx, req, nil)
+	}
+
+	err = a.verifySolution(ctx, subject, string(m.Payload), func(reason string) error {
+		return codec.Write(proto.MsgError, []byte(reason))
+	})
+	if err != nil {
+		return err
+	}
+
+	a.issueToken(ctx, subject, func(token string) error {
+		return codec.Write(proto.MsgToken, []byte(token))
+	})
+	return nil
+}
+
+// readMessage reads a frame of one of the given types. Framing errors are
+// reported to the client and returned as auth.ErrProtoMismatch.
+func (a *Auth) readMessage(ctx context.Context, codec *proto.Codec, types ...proto.MessageType) (proto.Message, error) {
+	m, err := codec.ExpectOneOfContext(ctx, types...)
+	switch {
+	case err == nil:
+		return m, nil
+	case errors.Is(err, proto.ErrUnsupportedVersion),
+		errors.Is(err, proto.ErrUnknownType),
+		errors.Is(err, proto.ErrFrameTooLarge),
+		errors.Is(err, proto.ErrUnexpectedType):
+		if werr := codec.Write(proto.MsgError, []byte(err.Error())); werr != nil {
+			log.FromContext(ctx).Error(werr)
+		}
+		return proto.Message{}, fmt.Errorf("%w: %v", auth.ErrProtoMismatch, err)
+	case ctx.Err() != nil:
+		return proto.Message{}, err
+	default:
+		return proto.Message{}, fmt.Errorf("failed to read %v: %w", types, err)
+	}
+}
+
+func (a *Auth) writeMessage(ctx context.Context, codec *proto.Codec, t proto.MessageType, payload []byte) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- codec.Write(t, payload)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", t, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,227 @@
+package pow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/pkg/core/build"
+	"wise-tcp/pkg/log"
+)
+
+type AdaptiveConfig struct {
+	Enabled  bool          `mapstructure:"enabled" envconfig:"POW_ADAPTIVE"`
+	Min      int           `mapstructure:"min"`
+	Max      int           `mapstructure:"max"`
+	Step     int           `mapstructure:"step"`
+	Interval time.Duration `mapstructure:"interval"`
+	// RaiseAt and LowerAt form the hysteresis band of the load score:
+	// difficulty goes up when the score reaches RaiseAt and down only once
+	// it falls to LowerAt.
+	RaiseAt float64 `mapstructure:"raiseAt"`
+	LowerAt float64 `mapstructure:"lowerAt"`
+	// AcceptRate is the accept rate (connections per second) treated as
+	// full load; 0 ignores the accept rate.
+	AcceptRate float64 `mapstructure:"acceptRate"`
+	// FailRate is the verify failure ratio treated as full load; 0 ignores
+	// verify failures.
+	FailRate float64 `mapstructure:"failRate"`
+}
+
+const (
+	defaultAdaptiveStep     = 1
+	defaultAdaptiveRange    = 8
+	defaultAdaptiveInterval = 5 * time.Second
+	defaultRaiseAt          = 0.8
+	defaultLowerAt          = 0.5
+	defaultFailRate         = 0.5
+	// minVerifySamples is the number of verifications needed in an interval
+	// before the failure ratio is taken into account.
+	minVerifySamples = 5
+)
+
+// DifficultyController adjusts the challenge difficulty to the live server
+// load. The load score is the highest of throttle saturation, accept rate
+// and verify failure rate, each normalized so that 1.0 means full load.
+type DifficultyController struct {
+	cfg     AdaptiveConfig
+	current atomic.Int64
+	load    atomic.Value
+
+	accepts  atomic.Uint64
+	verifies atomic.Uint64
+	failures atomic.Uint64
+
+	mu         sync.Mutex
+	saturation float64
+	peak       float64
+	last       time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func DifficultyBuilder(cfg Config) build.Builder {
+	return func(_ *build.Injector) (any, error) {
+		if cfg.AsyncMode {
+			// Async challenges come from the beacon, which does not see the
+			// server load.
+			return nil, fmt.Errorf("adaptive difficulty requires sync mode")
+		}
+		return NewDifficultyController(cfg.Difficulty, cfg.Adaptive)
+	}
+}
+
+func NewDifficultyController(base int, cfg AdaptiveConfig) (*DifficultyController, error) {
+	if cfg.Min == 0 {
+		cfg.Min = base
+	}
+	if cfg.Max == 0 {
+		cfg.Max = min(base+defaultAdaptiveRange, hashcash.MaxDifficulty)
+	}
+	if cfg.Step == 0 {
+		cfg.Step = defaultAdaptiveStep
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultAdaptiveInterval
+	}
+	if cfg.RaiseAt == 0 {
+		cfg.RaiseAt = defaultRaiseAt
+	}
+	if cfg.LowerAt == 0 {
+		cfg.LowerAt = defaultLowerAt
+	}
+	if cfg.FailRate == 0 {
+		cfg.FailRate = defaultFailRate
+	}
+
+	if cfg.Min <= 0 || cfg.Min > cfg.Max || cfg.Max > hashcash.MaxDifficulty {
+		return nil, fmt.Errorf("invalid difficulty range [%d, %d], max is %d", cfg.Min, cfg.Max, hashcash.MaxDifficulty)
+	}
+	if base < cfg.Min || base > cfg.Max {
+		return nil, fmt.Errorf("base difficulty %d outside range [%d, %d]", base, cfg.Min, cfg.Max)
+	}
+	if cfg.Step < 0 || cfg.Interval < 0 {
+		return nil, fmt.Errorf("step and interval must be positive")
+	}
+	if cfg.LowerAt >= cfg.RaiseAt {
+		return nil, fmt.Errorf("lowerAt (%v) must be below raiseAt (%v)", cfg.LowerAt, cfg.RaiseAt)
+	}
+
+	c := &DifficultyController{
+		cfg:  cfg,
+		last: time.Now(),
+	}
+	c.current.Store(int64(base))
+	c.load.Store(float64(0))
+
+	return c, nil
+}
+
+// Difficulty returns the current difficulty in bits.
+func (c *DifficultyController) Difficulty() int {
+	return int(c.current.Load())
+}
+
+// Load returns the load score computed at the last evaluation.
+func (c *DifficultyController) Load() float64 {
+	return c.load.Load().(float64)
+}
+
+func (c *DifficultyController) ObserveAccept() {
+	c.accepts.Add(1)
+}
+
+// ObserveSaturation records the throttle saturation, from 0 (idle) to 1
+// (every slot taken).
+func (c *DifficultyController) ObserveSaturation(saturation float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.saturation = saturation
+	c.peak = max(c.peak, saturation)
+}
+
+func (c *DifficultyController) ObserveVerify(ok bool) {
+	c.verifies.Add(1)
+	if !ok {
+		c.failures.Add(1)
+	}
+}
+
+func (c *DifficultyController) Start(_ context.Context) error {
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	go c.loop()
+
+	return nil
+}
+
+func (c *DifficultyController) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	close(c.stop)
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *DifficultyController) loop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.evaluate(now)
+		}
+	}
+}
+
+func (c *DifficultyController) evaluate(now time.Time) {
+	c.mu.Lock()
+	elapsed := now.Sub(c.last)
+	c.last = now
+	load := c.peak
+	c.peak = c.saturation
+	c.mu.Unlock()
+
+	accepts := c.accepts.Swap(0)
+	verifies := c.verifies.Swap(0)
+	failures := c.failures.Swap(0)
+
+	if c.cfg.AcceptRate > 0 && elapsed > 0 {
+		load = max(load, float64(accepts)/elapsed.Seconds()/c.cfg.AcceptRate)
+	}
+	if c.cfg.FailRate > 0 && verifies >= minVerifySamples {
+		load = max(load, float64(failures)/float64(verifies)/c.cfg.FailRate)
+	}
+	c.load.Store(load)
+
+	cur := c.Difficulty()
+	next := cur
+	switch {
+	case load >= c.cfg.RaiseAt:
+		next = min(cur+c.cfg.Step, c.cfg.Max)
+	case load <= c.cfg.LowerAt:
+		next = max(cur-c.cfg.Step, c.cfg.Min)
+	}
+
+	if next != cur {
+		c.current.Store(int64(next))
+		log.Infof("Difficulty adjusted: %d -> %d (load %.2f)", cur, next, load)
+	}
+}
@@ -0,0 +1,144 @@
+package pow
+
+import (
+	"testing"
+	"time"
+
+	"wise-tcp/pkg/core/build"
+)
+
+func newTestController(t *testing.T, cfg AdaptiveConfig) *DifficultyController {
+	t.Helper()
+	c, err := NewDifficultyController(20, cfg)
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+	return c
+}
+
+func TestDifficultyController_Defaults(t *testing.T) {
+	c := newTestController(t, AdaptiveConfig{})
+
+	if c.Difficulty() != 20 {
+		t.Errorf("expected base difficulty 20, got %d", c.Difficulty())
+	}
+	if c.cfg.Min != 20 || c.cfg.Max != 28 {
+		t.Errorf("expected default range [20, 28], got [%d, %d]", c.cfg.Min, c.cfg.Max)
+	}
+}
+
+func TestDifficultyController_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  AdaptiveConfig
+	}{
+		{"inverted range", AdaptiveConfig{Min: 24, Max: 18}},
+		{"base outside range", AdaptiveConfig{Min: 21, Max: 24}},
+		{"inverted thresholds", AdaptiveConfig{RaiseAt: 0.5, LowerAt: 0.6}},
+		{"max above hashcash max", AdaptiveConfig{Max: 60}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDifficultyController(20, tt.cfg); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestDifficultyController_MaxCapped(t *testing.T) {
+	c, err := NewDifficultyController(48, AdaptiveConfig{})
+	if err != nil {
+		t.Fatalf("failed to create controller: %v", err)
+	}
+	if c.cfg.Max != 52 {
+		t.Errorf("expected default max capped at 52, got %d", c.cfg.Max)
+	}
+}
+
+func TestDifficultyBuilder_Async(t *testing.T) {
+	cfg := Config{Difficulty: 20, AsyncMode: true, Adaptive: AdaptiveConfig{Enabled: true}}
+	if _, err := DifficultyBuilder(cfg)(build.NewInjector()); err == nil {
+		t.Error("expected error for adaptive difficulty in async mode")
+	}
+}
+
+func TestDifficultyController_Saturation(t *testing.T) {
+	c := newTestController(t, AdaptiveConfig{Min: 18, Max: 22})
+	now := time.Now()
+
+	c.ObserveSaturation(1)
+	c.ObserveSaturation(0.9)
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		c.evaluate(now)
+	}
+	if c.Difficulty() != 22 {
+		t.Errorf("expected difficulty to reach ceiling 22, got %d", c.Difficulty())
+	}
+
+	c.ObserveSaturation(0.6)
+	now = now.Add(time.Second)
+	c.evaluate(now)
+	if c.Difficulty() != 22 {
+		t.Errorf("expected difficulty to hold inside hysteresis band, got %d", c.Difficulty())
+	}
+
+	c.ObserveSaturation(0.1)
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Second)
+		c.evaluate(now)
+	}
+	if c.Difficulty() != 18 {
+		t.Errorf("expected difficulty to reach floor 18, got %d", c.Difficulty())
+	}
+}
+
+func TestDifficultyController_PeakWithinInterval(t *testing.T) {
+	c := newTestController(t, AdaptiveConfig{})
+
+	c.ObserveSaturation(1)
+	c.ObserveSaturation(0)
+	c.evaluate(time.Now().Add(time.Second))
+
+	if c.Difficulty() != 21 {
+		t.Errorf("expected a saturation spike to raise difficulty, got %d", c.Difficulty())
+	}
+	if c.Load() != 1 {
+		t.Errorf("expected load 1, got %v", c.Load())
+	}
+}
+
+func TestDifficultyController_AcceptRate(t *testing.T) {
+	c := newTestController(t, AdaptiveConfig{AcceptRate: 10})
+
+	for i := 0; i < 10; i++ {
+		c.ObserveAccept()
+	}
+	c.evaluate(c.last.Add(time.Second))
+
+	if c.Difficulty() != 21 {
+		t.Errorf("expected accept rate at capacity to raise difficulty, got %d", c.Difficulty())
+	}
+}
+
+func TestDifficultyController_FailRate(t *testing.T) {
+	c := newTestController(t, AdaptiveConfig{FailRate: 0.5})
+
+	for i := 0; i < minVerifySamples-1; i++ {
+		c.ObserveVerify(false)
+	}
+	c.evaluate(time.Now())
+	if c.Difficulty() != 20 {
+		t.Errorf("expected too few samples to be ignored, got %d", c.Difficulty())
+	}
+
+	for i := 0; i < minVerifySamples; i++ {
+		c.ObserveVerify(i%2 == 0)
+	}
+	c.evaluate(time.Now())
+	if c.Difficulty() != 21 {
+		t.Errorf("expected failure ratio to raise difficulty, got %d", c.Difficulty())
+	}
+}
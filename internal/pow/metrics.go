@@ -0,0 +1,34 @@
+package pow
+
+import (
+	"wise-tcp/pkg/metrics"
+)
+
+var (
+	challengesIssued = metrics.NewCounter("wise_pow_challenges_total",
+		"Challenges issued.")
+	verifySeconds = metrics.NewHistogram("wise_pow_verify_seconds",
+		"Time taken to verify a solution.", metrics.DefBuckets)
+)
+
+// cacheSizer is implemented by providers that can tell the number of
+// entries in their challenge cache.
+type cacheSizer interface {
+	CacheSize() (int, bool)
+}
+
+// registerGauges exports the difficulty of a and the size of its challenge
+// cache, if the provider knows it.
+func registerGauges(a *Auth) {
+	metrics.NewGaugeFunc("wise_pow_difficulty", "Difficulty of newly issued challenges.", func() float64 {
+		return float64(a.baseDifficulty())
+	})
+	if s, ok := a.provider.(cacheSizer); ok {
+		if _, ok = s.CacheSize(); ok {
+			metrics.NewGaugeFunc("wise_pow_cache_entries", "Entries in the challenge cache.", func() float64 {
+				n, _ := s.CacheSize()
+				return float64(n)
+			})
+		}
+	}
+}
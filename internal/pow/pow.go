@@ -1,12 +1,33 @@
 package pow
 
+import (
+	"context"
+
+	"wise-tcp/internal/auth"
+)
+
 type Provider interface {
 	Challenge(subject string, difficulty int) (string, error)
-	Verify(response string) (bool, error)
+	// VerifySubject verifies response presented by the client at addr.
+	VerifySubject(response string, addr string) (bool, error)
+}
+
+// responseChecker is implemented by providers that can tell whether a
+// response is valid without spending its challenge.
+type responseChecker interface {
+	Check(response, addr string, minDifficulty int) bool
 }
 
 type Solver interface {
 	Solve(challenge string) (string, error)
+	SolveContext(ctx context.Context, challenge string) (string, error)
+}
+
+// TokenIssuer mints bearer tokens for clients that solved a challenge and
+// authorizes the tokens they present instead of a solution.
+type TokenIssuer interface {
+	auth.RequestAuthorizer
+	Mint(subject string) (string, error)
 }
 
 type ProviderFactory interface {
@@ -16,7 +37,30 @@ type ProviderFactory interface {
 type ProviderBuilder func() (Provider, error)
 
 type Config struct {
-	Difficulty int    `mapstructure:"diff" envconfig:"POW_DIFFICULTY"`
-	AsyncMode  bool   `mapstructure:"async" envconfig:"POW_ASYNC"`
-	RedisAddr  string `mapstructure:"redis" envconfig:"REDIS_ADDR"`
+	Difficulty  int              `mapstructure:"diff" envconfig:"POW_DIFFICULTY"`
+	AsyncMode   bool             `mapstructure:"async" envconfig:"POW_ASYNC"`
+	RedisAddr   string           `mapstructure:"redis" envconfig:"REDIS_ADDR"`
+	Algorithm   string           `mapstructure:"alg" envconfig:"POW_ALG"`
+	AllowedAlgs []string         `mapstructure:"allowedAlgs"`
+	Adaptive    AdaptiveConfig   `mapstructure:"adaptive"`
+	Reputation  ReputationConfig `mapstructure:"reputation"`
+	Stateless   StatelessConfig  `mapstructure:"stateless"`
+	// Binding is the subject binding policy: exact, ip, prefix64 or none.
+	Binding string `mapstructure:"binding" envconfig:"POW_BINDING"`
+	// MaxLineLength limits the length of a text protocol response line.
+	MaxLineLength int `mapstructure:"maxLine"`
+}
+
+// StatelessConfig enables HMAC-signed challenges. Secrets are base64
+// encoded; ActiveKey selects the key used for signing, while the remaining
+// keys are still accepted for verification.
+type StatelessConfig struct {
+	Enabled   bool         `mapstructure:"enabled" envconfig:"POW_STATELESS"`
+	ActiveKey string       `mapstructure:"activeKey"`
+	Keys      []SigningKey `mapstructure:"keys"`
+}
+
+type SigningKey struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
 }
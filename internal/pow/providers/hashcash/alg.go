@@ -0,0 +1,69 @@
+package hashcash
+
+import (
+	"crypto/sha1" //nolint:gosec // sha1 is kept for legacy interop only
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+const (
+	AlgSHA1      = "sha1"
+	AlgSHA256    = "sha256"
+	AlgSHA512    = "sha512"
+	AlgSHA512256 = "sha512/256"
+)
+
+var (
+	ErrUnsupportedAlg = errors.New("unsupported algorithm")
+	ErrAlgNotAllowed  = errors.New("algorithm not allowed")
+)
+
+var algorithms = map[string]func() hash.Hash{
+	AlgSHA1:      sha1.New,
+	AlgSHA256:    sha256.New,
+	AlgSHA512:    sha512.New,
+	AlgSHA512256: sha512.New512_256,
+}
+
+// Algorithms returns the names of all supported hash functions.
+func Algorithms() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateAlgorithm returns ErrUnsupportedAlg if alg is not in the table.
+func ValidateAlgorithm(alg string) error {
+	_, err := newHashFunc(alg)
+	return err
+}
+
+func normalizeAlg(alg string) string {
+	return strings.ToLower(strings.TrimSpace(alg))
+}
+
+func newHashFunc(alg string) (func() hash.Hash, error) {
+	fn, ok := algorithms[normalizeAlg(alg)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+	}
+	return fn, nil
+}
+
+func sumAlg(alg string, data []byte) ([]byte, error) {
+	fn, err := newHashFunc(alg)
+	if err != nil {
+		return nil, err
+	}
+	h := fn()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
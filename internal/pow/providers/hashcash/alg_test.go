@@ -0,0 +1,73 @@
+package hashcash_test
+
+import (
+	"errors"
+	"testing"
+
+	"wise-tcp/internal/pow/providers/hashcash"
+)
+
+func TestAlgorithms_SolveAndVerify(t *testing.T) {
+	for _, alg := range hashcash.Algorithms() {
+		t.Run(alg, func(t *testing.T) {
+			provider := hashcash.NewProvider(hashcash.WithAlgorithm(alg))
+
+			challenge, err := provider.Challenge("test_subject", 10)
+			if err != nil {
+				t.Fatalf("Failed to create challenge: %v", err)
+			}
+
+			ch, err := hashcash.ParseChallenge(challenge)
+			if err != nil {
+				t.Fatalf("Failed to parse challenge: %v", err)
+			}
+			if ch.Alg != alg {
+				t.Errorf("Expected algorithm %s, got %s", alg, ch.Alg)
+			}
+
+			response, err := hashcash.NewSolver().Solve(challenge)
+			if err != nil {
+				t.Fatalf("Failed to solve challenge: %v", err)
+			}
+
+			valid, err := provider.Verify(response)
+			if err != nil {
+				t.Fatalf("Failed to verify response: %v", err)
+			}
+			if !valid {
+				t.Error("Expected valid solution, but verification failed")
+			}
+		})
+	}
+}
+
+func TestProvider_Verify_AlgNotAllowed(t *testing.T) {
+	issuer := hashcash.NewProvider(hashcash.WithAlgorithm(hashcash.AlgSHA1))
+	provider := hashcash.NewProvider(hashcash.WithAllowedAlgorithms(hashcash.AlgSHA256, hashcash.AlgSHA512))
+
+	challenge, err := issuer.Challenge("test_subject", 8)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+
+	response, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	valid, err := provider.Verify(response)
+	if !errors.Is(err, hashcash.ErrAlgNotAllowed) {
+		t.Errorf("Expected ErrAlgNotAllowed, got %v", err)
+	}
+	if valid {
+		t.Error("Expected response with disallowed algorithm to be rejected")
+	}
+}
+
+func TestProvider_UnsupportedAlgorithm(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithAlgorithm("md5"))
+
+	if _, err := provider.Challenge("test_subject", 8); !errors.Is(err, hashcash.ErrUnsupportedAlg) {
+		t.Errorf("Expected ErrUnsupportedAlg, got %v", err)
+	}
+}
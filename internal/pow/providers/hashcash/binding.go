@@ -0,0 +1,94 @@
+package hashcash
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ErrSubjectMismatch is returned by VerifySubject when the response was
+// issued to a different client than the one presenting it.
+var ErrSubjectMismatch = errors.New("subject mismatch")
+
+// Binding is the policy for matching the challenge subject against the
+// address of the client presenting the response.
+type Binding string
+
+const (
+	// BindExact requires the same IP and port.
+	BindExact Binding = "exact"
+	// BindIP requires the same IP, allowing a different source port, as is
+	// the case in async mode.
+	BindIP Binding = "ip"
+	// BindPrefix64 requires the same IPv4 address or IPv6 /64 prefix.
+	BindPrefix64 Binding = "prefix64"
+	// BindNone disables subject binding.
+	BindNone Binding = "none"
+)
+
+func ParseBinding(s string) (Binding, error) {
+	switch b := Binding(strings.ToLower(strings.TrimSpace(s))); b {
+	case BindExact, BindIP, BindPrefix64, BindNone:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown subject binding %q", s)
+	}
+}
+
+// Match reports whether the client at addr may spend a challenge issued
+// to subject, both given as "host:port" addresses.
+func (b Binding) Match(subject, addr string) bool {
+	switch b {
+	case BindNone:
+		return true
+	case BindExact:
+		return strings.TrimSpace(subject) == strings.TrimSpace(addr)
+	case BindIP:
+		return AddrKey(subject, 128) == AddrKey(addr, 128)
+	case BindPrefix64:
+		return AddrKey(subject, 64) == AddrKey(addr, 64)
+	default:
+		return false
+	}
+}
+
+// AddrKey maps addr to its IPv4 address, or to its IPv6 prefix of the given
+// length. The port is dropped; values that are not IP addresses are
+// returned unchanged.
+func AddrKey(addr string, ipv6Prefix int) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	ip = ip.Unmap()
+	if ip.Is4() {
+		return ip.String()
+	}
+	prefix, err := ip.WithZone("").Prefix(ipv6Prefix)
+	if err != nil {
+		return ip.String()
+	}
+	return prefix.String()
+}
+
+func (p *Provider) checkSubject(r *Response, addr string) error {
+	if p.binding == BindNone {
+		return nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(r.Subject)
+	if err != nil {
+		return fmt.Errorf("%w: malformed subject", ErrSubjectMismatch)
+	}
+	if !p.binding.Match(string(raw), addr) {
+		return fmt.Errorf("%w: issued to %s, presented by %s", ErrSubjectMismatch, raw, addr)
+	}
+	return nil
+}
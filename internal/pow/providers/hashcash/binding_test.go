@@ -0,0 +1,66 @@
+package hashcash_test
+
+import (
+	"errors"
+	"testing"
+
+	"wise-tcp/internal/pow/providers/hashcash"
+)
+
+func TestBinding_Match(t *testing.T) {
+	tests := []struct {
+		binding hashcash.Binding
+		subject string
+		addr    string
+		want    bool
+	}{
+		{hashcash.BindExact, "192.0.2.1:5000", "192.0.2.1:5000", true},
+		{hashcash.BindExact, "192.0.2.1:5000", "192.0.2.1:5001", false},
+		{hashcash.BindIP, "192.0.2.1:5000", "192.0.2.1:5001", true},
+		{hashcash.BindIP, "192.0.2.1:5000", "192.0.2.2:5000", false},
+		{hashcash.BindIP, "[::ffff:192.0.2.1]:5000", "192.0.2.1:6000", true},
+		{hashcash.BindIP, "[2001:db8::1]:5000", "[2001:db8::2]:5000", false},
+		{hashcash.BindPrefix64, "[2001:db8::1]:5000", "[2001:db8::2]:6000", true},
+		{hashcash.BindPrefix64, "[2001:db8::1]:5000", "[2001:db8:0:1::1]:5000", false},
+		{hashcash.BindPrefix64, "192.0.2.1:5000", "192.0.2.2:5000", false},
+		{hashcash.BindNone, "192.0.2.1:5000", "198.51.100.1:5000", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.binding.Match(tt.subject, tt.addr); got != tt.want {
+			t.Errorf("%s.Match(%q, %q) = %v, want %v", tt.binding, tt.subject, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParseBinding(t *testing.T) {
+	if b, err := hashcash.ParseBinding("IP"); err != nil || b != hashcash.BindIP {
+		t.Errorf("Expected BindIP, got %v, %v", b, err)
+	}
+	if _, err := hashcash.ParseBinding("subnet"); err == nil {
+		t.Error("Expected error for unknown binding")
+	}
+}
+
+func TestProvider_VerifySubject(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithBinding(hashcash.BindIP))
+
+	challenge, err := provider.Challenge("192.0.2.1:5000", 8)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	response, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	valid, err := provider.VerifySubject(response, "198.51.100.7:5000")
+	if !errors.Is(err, hashcash.ErrSubjectMismatch) || valid {
+		t.Fatalf("Expected ErrSubjectMismatch, got %v, %v", valid, err)
+	}
+
+	valid, err = provider.VerifySubject(response, "192.0.2.1:6000")
+	if err != nil || !valid {
+		t.Errorf("Expected the rejected attempt not to burn the challenge, got %v, %v", valid, err)
+	}
+}
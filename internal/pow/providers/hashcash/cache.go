@@ -9,14 +9,21 @@ import (
 
 type MemoryCache struct {
 	fingerprints map[string]time.Time
+	counters     map[string]counter
 	mu           sync.RWMutex
 	ticker       *time.Ticker
 	stop         chan struct{}
 }
 
+type counter struct {
+	n       int64
+	expires time.Time
+}
+
 func NewMemoryCache(cleanupInterval time.Duration) *MemoryCache {
 	c := &MemoryCache{
 		fingerprints: make(map[string]time.Time),
+		counters:     make(map[string]counter),
 		ticker:       time.NewTicker(cleanupInterval),
 		stop:         make(chan struct{}),
 	}
@@ -46,6 +53,44 @@ func (c *MemoryCache) Add(fingerprint string, _ string, expiry time.Duration) er
 	return nil
 }
 
+func (c *MemoryCache) AddIfAbsent(fingerprint string, _ string, expiry time.Duration) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if expirationTime, exists := c.fingerprints[fingerprint]; exists && now.Before(expirationTime) {
+		return false, nil
+	}
+
+	c.fingerprints[fingerprint] = now.Add(expiry)
+	return true, nil
+}
+
+func (c *MemoryCache) Incr(key string, expiration time.Duration) (int64, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctr, exists := c.counters[key]
+	if !exists || !now.Before(ctr.expires) {
+		ctr = counter{expires: now.Add(expiration)}
+	}
+	ctr.n++
+	c.counters[key] = ctr
+	return ctr.n, nil
+}
+
+// Len returns the number of fingerprints in the cache, including expired
+// ones not yet cleaned up.
+func (c *MemoryCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.fingerprints)
+}
+
 func (c *MemoryCache) Remove(fingerprint string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -87,4 +132,9 @@ func (c *MemoryCache) cleanup() {
 			delete(c.fingerprints, fingerprint)
 		}
 	}
+	for key, ctr := range c.counters {
+		if now.After(ctr.expires) {
+			delete(c.counters, key)
+		}
+	}
 }
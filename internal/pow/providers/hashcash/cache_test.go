@@ -108,3 +108,44 @@ func TestCache_Concurrency(t *testing.T) {
 		t.Fatalf("unexpected error in second goroutine: %v", err2)
 	}
 }
+
+func TestCache_AddIfAbsent(t *testing.T) {
+	cache := hashcash.NewMemoryCache(10 * time.Second)
+	defer cache.Stop(context.Background())
+
+	added, err := cache.AddIfAbsent("spent123", "", 50*time.Millisecond)
+	if err != nil || !added {
+		t.Fatalf("expected fingerprint to be added, got %v, %v", added, err)
+	}
+
+	added, err = cache.AddIfAbsent("spent123", "", 50*time.Millisecond)
+	if err != nil || added {
+		t.Fatalf("expected duplicate fingerprint to be rejected, got %v, %v", added, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	added, err = cache.AddIfAbsent("spent123", "", 50*time.Millisecond)
+	if err != nil || !added {
+		t.Fatalf("expected expired fingerprint to be replaced, got %v, %v", added, err)
+	}
+}
+
+func TestCache_Incr(t *testing.T) {
+	cache := hashcash.NewMemoryCache(10 * time.Second)
+	defer cache.Stop(context.Background())
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := cache.Incr("token123", 50*time.Millisecond)
+		if err != nil || n != want {
+			t.Fatalf("expected counter %d, got %d, %v", want, n, err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	n, err := cache.Incr("token123", 50*time.Millisecond)
+	if err != nil || n != 1 {
+		t.Fatalf("expected expired counter to restart at 1, got %d, %v", n, err)
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"strings"
 )
 
-const maxDifficulty = 52
+// MaxDifficulty is the highest difficulty a challenge can have.
+const MaxDifficulty = 52
 
 type Challenge struct {
 	Payload
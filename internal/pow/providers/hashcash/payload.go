@@ -41,7 +41,7 @@ func (p *Payload) FromString(parts []string) error {
 	p.Version = version
 
 	bits, err := strconv.Atoi(parts[1])
-	if err != nil || bits <= 0 || bits > maxDifficulty {
+	if err != nil || bits <= 0 || bits > MaxDifficulty {
 		return fmt.Errorf("invalid difficulty")
 	}
 	p.Difficulty = bits
@@ -15,10 +15,18 @@ type Provider struct {
 	cache      ChallengeCache
 	difficulty int
 	expiry     time.Duration
+	alg        string
+	allowed    map[string]struct{}
+	signer     *Signer
+	binding    Binding
 }
 
 type ProviderOption func(*Provider)
 
+// ErrReplay is returned by Verify for responses whose challenge is unknown,
+// expired or already spent.
+var ErrReplay = errors.New("replay protection failed")
+
 const defaultDifficulty = 20
 const defaultExpiry = 1 * time.Minute
 const defaultAlg = "sha256"
@@ -29,6 +37,12 @@ type Config struct {
 
 type ChallengeCache interface {
 	Add(fingerprint string, challenge string, expiration time.Duration) error
+	// AddIfAbsent stores fingerprint unless it is already present and
+	// reports whether it was added.
+	AddIfAbsent(fingerprint string, challenge string, expiration time.Duration) (bool, error)
+	// Incr increments the counter stored under key and returns the new
+	// value. A new counter expires after expiration.
+	Incr(key string, expiration time.Duration) (int64, error)
 	Remove(fingerprint string) error
 	core.Starter
 	core.Stopper
@@ -40,6 +54,40 @@ func WithDifficulty(difficulty int) ProviderOption {
 	}
 }
 
+// WithAlgorithm sets the hash function used for issued challenges.
+func WithAlgorithm(alg string) ProviderOption {
+	return func(p *Provider) {
+		p.alg = normalizeAlg(alg)
+	}
+}
+
+// WithAllowedAlgorithms sets the algorithms accepted by Verify. By default,
+// only the algorithm used for issuing challenges is accepted.
+func WithAllowedAlgorithms(algs ...string) ProviderOption {
+	return func(p *Provider) {
+		p.allowed = make(map[string]struct{}, len(algs))
+		for _, alg := range algs {
+			p.allowed[normalizeAlg(alg)] = struct{}{}
+		}
+	}
+}
+
+// WithSigner enables stateless mode: challenges are signed by s instead
+// of being stored, and the cache only records spent challenges.
+func WithSigner(s *Signer) ProviderOption {
+	return func(p *Provider) {
+		p.signer = s
+	}
+}
+
+// WithBinding sets how VerifySubject matches the challenge subject against
+// the client presenting the response. Defaults to BindNone.
+func WithBinding(b Binding) ProviderOption {
+	return func(p *Provider) {
+		p.binding = b
+	}
+}
+
 func WithCache(cache ChallengeCache) ProviderOption {
 	return func(provider *Provider) {
 		provider.cache = cache
@@ -50,12 +98,18 @@ func NewProvider(opts ...ProviderOption) *Provider {
 	p := &Provider{
 		difficulty: defaultDifficulty,
 		expiry:     defaultExpiry,
+		alg:        defaultAlg,
+		binding:    BindNone,
 	}
 
 	for _, opt := range opts {
 		opt(p)
 	}
 
+	if p.allowed == nil {
+		p.allowed = map[string]struct{}{p.alg: {}}
+	}
+
 	if p.cache == nil {
 		p.cache = NewMemoryCache(10 * time.Second)
 	}
@@ -67,44 +121,48 @@ func (p *Provider) Difficulty() int {
 	return p.difficulty
 }
 
+// MaxDifficulty returns the highest difficulty a challenge can have.
+func (p *Provider) MaxDifficulty() int {
+	return MaxDifficulty
+}
+
 func (p *Provider) Expiry() time.Duration {
 	return p.expiry
 }
 
+func (p *Provider) Algorithm() string {
+	return p.alg
+}
+
+// CacheSize returns the number of entries in the challenge cache, if the
+// cache can tell.
+func (p *Provider) CacheSize() (int, bool) {
+	if c, ok := p.cache.(interface{ Len() int }); ok {
+		return c.Len(), true
+	}
+	return 0, false
+}
+
 func (p *Provider) Start(ctx context.Context) error {
 	return p.cache.Start(ctx)
 }
 
+func (p *Provider) CheckHealth(ctx context.Context) error {
+	return core.CheckHealth(ctx, p.cache)
+}
+
 func (p *Provider) Stop(ctx context.Context) error {
 	return p.cache.Stop(ctx)
 }
 
 func (p *Provider) Challenge(subject string, difficulty int) (string, error) {
-	subject = base64.RawURLEncoding.EncodeToString([]byte(subject))
-	nonce := make([]byte, 16)
-	if _, err := rand.Read(nonce); nil != err {
+	c, err := p.RawChallenge(subject, difficulty)
+	if err != nil {
 		return "", err
 	}
 
-	if subject == "" {
-		return "", fmt.Errorf("subject must not be empty")
-	}
-
-	if difficulty == 0 {
-		difficulty = p.difficulty
-	} else if difficulty < 0 {
-		return "", fmt.Errorf("difficulty must be positive or 0, got %d", difficulty)
-	}
-
-	c := &Challenge{
-		Payload: Payload{
-			Version:    1,
-			Difficulty: difficulty,
-			ExpiresAt:  time.Now().Add(p.expiry),
-			Subject:    subject,
-			Nonce:      base64.RawURLEncoding.EncodeToString(nonce),
-			Alg:        defaultAlg,
-		},
+	if p.signer != nil {
+		return c.String(), nil
 	}
 
 	fingerprint, err := c.Fingerprint()
@@ -131,6 +189,10 @@ func (p *Provider) RawChallenge(subject string, difficulty int) (*Challenge, err
 		return nil, fmt.Errorf("subject must not be empty")
 	}
 
+	if err := ValidateAlgorithm(p.alg); err != nil {
+		return nil, err
+	}
+
 	if difficulty == 0 {
 		difficulty = p.difficulty
 	} else if difficulty < 0 {
@@ -144,25 +206,82 @@ func (p *Provider) RawChallenge(subject string, difficulty int) (*Challenge, err
 			ExpiresAt:  time.Now().Add(p.expiry),
 			Subject:    subject,
 			Nonce:      base64.RawURLEncoding.EncodeToString(nonce),
-			Alg:        defaultAlg,
+			Alg:        p.alg,
 		},
 	}
 
+	if p.signer != nil {
+		if err := p.signer.Sign(&c.Payload); err != nil {
+			return nil, err
+		}
+	}
+
 	return c, nil
 }
 
+// Verify checks response without subject binding; use VerifySubject when
+// the presenting client is known.
 func (p *Provider) Verify(response string) (bool, error) {
+	return p.verify(response, nil)
+}
+
+// VerifySubject verifies response on behalf of the client at addr, which
+// must match the challenge subject under the configured binding policy.
+func (p *Provider) VerifySubject(response string, addr string) (bool, error) {
+	return p.verify(response, &addr)
+}
+
+// Check reports whether response solves a live challenge of at least
+// minDifficulty issued to the client at addr. Unlike VerifySubject it does
+// not spend the challenge or touch the cache, so it suits a cheap look at
+// a response before the real verification.
+func (p *Provider) Check(response, addr string, minDifficulty int) bool {
+	r := Response{}
+	if err := r.FromString(response); err != nil {
+		return false
+	}
+	if r.Difficulty < minDifficulty || !time.Now().Before(r.ExpiresAt) {
+		return false
+	}
+	if err := p.checkSubject(&r, addr); err != nil {
+		return false
+	}
+	if _, ok := p.allowed[normalizeAlg(r.Alg)]; !ok {
+		return false
+	}
+	if p.signer != nil && p.signer.Verify(&r.Payload) != nil {
+		return false
+	}
+	return r.Verify() == nil
+}
+
+func (p *Provider) verify(response string, addr *string) (bool, error) {
 	r := Response{}
 	if err := r.FromString(response); err != nil {
 		return false, err
 	}
 
+	if addr != nil {
+		if err := p.checkSubject(&r, *addr); err != nil {
+			return false, err
+		}
+	}
+
+	if _, ok := p.allowed[normalizeAlg(r.Alg)]; !ok {
+		return false, fmt.Errorf("%w: %q", ErrAlgNotAllowed, r.Alg)
+	}
+
 	fingerprint, err := r.Fingerprint()
 	if err != nil {
 		return false, fmt.Errorf("failed to compute fingerprint: %v", err)
 	}
+
+	if p.signer != nil {
+		return p.verifyStateless(&r, fingerprint)
+	}
+
 	if err = p.cache.Remove(fingerprint); err != nil {
-		return false, fmt.Errorf("replay protection failed: %v", err)
+		return false, fmt.Errorf("%w: %v", ErrReplay, err)
 	}
 
 	if err = r.Verify(); err != nil {
@@ -173,3 +292,33 @@ func (p *Provider) Verify(response string) (bool, error) {
 	}
 	return true, nil
 }
+
+// verifyStateless checks the signature and the solution, and only then
+// records the challenge as spent, so that unsolved challenges never take
+// up cache space.
+func (p *Provider) verifyStateless(r *Response, fingerprint string) (bool, error) {
+	if err := p.signer.Verify(&r.Payload); err != nil {
+		return false, err
+	}
+
+	if err := r.Verify(); err != nil {
+		if errors.Is(err, ErrInvalidSolution) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	ttl := time.Until(r.ExpiresAt)
+	if ttl <= 0 {
+		return false, fmt.Errorf("%w: challenge expired", ErrReplay)
+	}
+
+	added, err := p.cache.AddIfAbsent(fingerprint, "", ttl)
+	if err != nil {
+		return false, fmt.Errorf("failed to record spent challenge: %w", err)
+	}
+	if !added {
+		return false, fmt.Errorf("%w: challenge already spent", ErrReplay)
+	}
+	return true, nil
+}
@@ -132,3 +132,46 @@ func TestReplayProtection(t *testing.T) {
 		t.Error("Expected second verification to fail due to replay protection, got valid")
 	}
 }
+
+func TestProvider_Check(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithBinding(hashcash.BindIP))
+
+	challenge, err := provider.Challenge("192.0.2.1:5000", 8)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	response, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+	// Hard enough that a made-up solution is practically never valid.
+	hard, err := provider.Challenge("192.0.2.1:5000", 24)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		addr     string
+		minDiff  int
+		want     bool
+	}{
+		{"valid", response, "192.0.2.1:6000", 8, true},
+		{"other client", response, "198.51.100.7:5000", 8, false},
+		{"too easy", response, "192.0.2.1:6000", 9, false},
+		{"unsolved", hard + ":AAAA", "192.0.2.1:6000", 8, false},
+		{"garbage", "X-Response", "192.0.2.1:6000", 0, false},
+	}
+	for _, tt := range tests {
+		if got := provider.Check(tt.response, tt.addr, tt.minDiff); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// Checking does not spend the challenge.
+	valid, err := provider.VerifySubject(response, "192.0.2.1:6000")
+	if err != nil || !valid {
+		t.Errorf("Expected response to verify after check, got %v, %v", valid, err)
+	}
+}
@@ -9,6 +9,15 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// incrScript increments a counter and sets its expiry when it is created.
+var incrScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
 type RedisCache struct {
 	redisClient *redis.Client
 	context     context.Context
@@ -41,6 +50,23 @@ func (r *RedisCache) Add(fingerprint string, challenge string, expiration time.D
 	return nil
 }
 
+func (r *RedisCache) AddIfAbsent(fingerprint string, challenge string, expiration time.Duration) (bool, error) {
+	added, err := r.redisClient.SetNX(r.context, "pow:spent:"+fingerprint, challenge, expiration).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to store fingerprint: %w", err)
+	}
+	return added, nil
+}
+
+func (r *RedisCache) Incr(key string, expiration time.Duration) (int64, error) {
+	n, err := incrScript.Run(r.context, r.redisClient, []string{"pow:counter:" + key},
+		max(expiration.Milliseconds(), 1)).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment counter: %w", err)
+	}
+	return n, nil
+}
+
 func (r *RedisCache) Remove(fingerprint string) error {
 	exists, err := r.Exists("pow:challenge:" + fingerprint)
 	if err != nil {
@@ -57,6 +83,13 @@ func (r *RedisCache) Remove(fingerprint string) error {
 	return err
 }
 
+func (r *RedisCache) CheckHealth(ctx context.Context) error {
+	if err := r.redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("redis %s: %w", r.addr, err)
+	}
+	return nil
+}
+
 func (r *RedisCache) Exists(fingerprint string) (bool, error) {
 	exists, err := r.redisClient.Exists(r.context, fingerprint).Result()
 	if err != nil {
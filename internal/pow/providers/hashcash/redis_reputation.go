@@ -0,0 +1,100 @@
+package hashcash
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const reputationKeyPrefix = "pow:reputation:"
+
+// reputationAddScript decays the stored score to the current time, adds
+// the delta and stores the result atomically. Scores are kept for ten
+// half-lives, after which they are negligible.
+var reputationAddScript = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 's', 't')
+local now = tonumber(ARGV[2])
+local hl = tonumber(ARGV[3])
+local s = tonumber(v[1]) or 0
+local t = tonumber(v[2]) or now
+if hl > 0 and now > t then
+	s = s * math.pow(2, -(now - t) / hl)
+end
+s = s + tonumber(ARGV[1])
+if s < 0 then
+	s = 0
+end
+redis.call('HSET', KEYS[1], 's', tostring(s), 't', now)
+redis.call('PEXPIRE', KEYS[1], math.max(hl * 10, 1000))
+return tostring(s)
+`)
+
+type RedisReputation struct {
+	redisClient *redis.Client
+	context     context.Context
+	addr        string
+	halfLife    time.Duration
+}
+
+func NewRedisReputation(redisAddress string, halfLife time.Duration) *RedisReputation {
+	return &RedisReputation{
+		addr:     redisAddress,
+		halfLife: halfLife,
+	}
+}
+
+func (r *RedisReputation) Start(ctx context.Context) error {
+	r.redisClient = redis.NewClient(&redis.Options{
+		Addr: r.addr,
+	})
+	r.context = ctx
+	return nil
+}
+
+func (r *RedisReputation) Stop(_ context.Context) error {
+	return r.redisClient.Close()
+}
+
+func (r *RedisReputation) CheckHealth(ctx context.Context) error {
+	if err := r.redisClient.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("redis %s: %w", r.addr, err)
+	}
+	return nil
+}
+
+func (r *RedisReputation) Add(key string, delta float64) (float64, error) {
+	res, err := reputationAddScript.Run(r.context, r.redisClient, []string{reputationKeyPrefix + key},
+		delta, time.Now().UnixMilli(), r.halfLife.Milliseconds()).Text()
+	if err != nil {
+		return 0, fmt.Errorf("failed to update reputation: %w", err)
+	}
+	score, err := strconv.ParseFloat(res, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reputation score %q: %w", res, err)
+	}
+	return score, nil
+}
+
+func (r *RedisReputation) Score(key string) (float64, error) {
+	v, err := r.redisClient.HMGet(r.context, reputationKeyPrefix+key, "s", "t").Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve reputation: %w", err)
+	}
+	if len(v) != 2 || v[0] == nil || v[1] == nil {
+		return 0, nil
+	}
+
+	score, err := strconv.ParseFloat(fmt.Sprint(v[0]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reputation score: %w", err)
+	}
+	at, err := strconv.ParseInt(fmt.Sprint(v[1]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reputation timestamp: %w", err)
+	}
+
+	return decay(score, time.Since(time.UnixMilli(at)), r.halfLife), nil
+}
@@ -0,0 +1,117 @@
+package hashcash
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"wise-tcp/pkg/core"
+)
+
+// ReputationStore keeps a non-negative score per key that decays
+// exponentially over time with a fixed half-life.
+type ReputationStore interface {
+	// Add adds delta to the decayed score of key and returns the new score.
+	Add(key string, delta float64) (float64, error)
+	Score(key string) (float64, error)
+	core.Starter
+	core.Stopper
+}
+
+// reputationEpsilon is the score below which entries are dropped.
+const reputationEpsilon = 0.01
+
+type reputationEntry struct {
+	score float64
+	at    time.Time
+}
+
+type MemoryReputation struct {
+	entries  map[string]reputationEntry
+	halfLife time.Duration
+	mu       sync.Mutex
+	ticker   *time.Ticker
+	stop     chan struct{}
+	now      func() time.Time
+}
+
+func NewMemoryReputation(halfLife, cleanupInterval time.Duration) *MemoryReputation {
+	return &MemoryReputation{
+		entries:  make(map[string]reputationEntry),
+		halfLife: halfLife,
+		ticker:   time.NewTicker(cleanupInterval),
+		stop:     make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+func (r *MemoryReputation) Start(_ context.Context) error {
+	go r.startCleanupWorker()
+	return nil
+}
+
+func (r *MemoryReputation) Stop(_ context.Context) error {
+	close(r.stop)
+	return nil
+}
+
+func (r *MemoryReputation) Add(key string, delta float64) (float64, error) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	score := max(r.decayed(r.entries[key], now)+delta, 0)
+	if score < reputationEpsilon {
+		delete(r.entries, key)
+		return 0, nil
+	}
+	r.entries[key] = reputationEntry{score: score, at: now}
+	return score, nil
+}
+
+func (r *MemoryReputation) Score(key string) (float64, error) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.decayed(r.entries[key], now), nil
+}
+
+func (r *MemoryReputation) decayed(e reputationEntry, now time.Time) float64 {
+	return decay(e.score, now.Sub(e.at), r.halfLife)
+}
+
+func decay(score float64, elapsed, halfLife time.Duration) float64 {
+	if score == 0 || elapsed <= 0 || halfLife <= 0 {
+		return score
+	}
+	return score * math.Exp2(-float64(elapsed)/float64(halfLife))
+}
+
+func (r *MemoryReputation) startCleanupWorker() {
+	for {
+		select {
+		case <-r.ticker.C:
+			r.cleanup()
+		case <-r.stop:
+			r.ticker.Stop()
+			return
+		}
+	}
+}
+
+func (r *MemoryReputation) cleanup() {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, e := range r.entries {
+		if r.decayed(e, now) < reputationEpsilon {
+			delete(r.entries, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package hashcash
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMemoryReputation_AddAndDecay(t *testing.T) {
+	r := NewMemoryReputation(time.Minute, time.Minute)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	score, err := r.Add("1.2.3.4", 4)
+	if err != nil || score != 4 {
+		t.Fatalf("expected score 4, got %v (%v)", score, err)
+	}
+
+	now = now.Add(time.Minute)
+	score, _ = r.Score("1.2.3.4")
+	if math.Abs(score-2) > 1e-9 {
+		t.Errorf("expected score to halve after one half-life, got %v", score)
+	}
+
+	score, _ = r.Add("1.2.3.4", 1)
+	if math.Abs(score-3) > 1e-9 {
+		t.Errorf("expected decayed score plus delta, got %v", score)
+	}
+}
+
+func TestMemoryReputation_NonNegative(t *testing.T) {
+	r := NewMemoryReputation(time.Minute, time.Minute)
+
+	score, _ := r.Add("1.2.3.4", -5)
+	if score != 0 {
+		t.Errorf("expected score to be clamped at 0, got %v", score)
+	}
+
+	_, _ = r.Add("1.2.3.4", 2)
+	score, _ = r.Add("1.2.3.4", -3)
+	if score != 0 {
+		t.Errorf("expected score to be clamped at 0, got %v", score)
+	}
+}
+
+func TestMemoryReputation_Cleanup(t *testing.T) {
+	r := NewMemoryReputation(time.Millisecond, 10*time.Millisecond)
+	_ = r.Start(context.Background())
+	defer r.Stop(context.Background())
+
+	_, _ = r.Add("1.2.3.4", 1)
+	time.Sleep(50 * time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) != 0 {
+		t.Errorf("expected decayed entries to be cleaned up, got %d", len(r.entries))
+	}
+}
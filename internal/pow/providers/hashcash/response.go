@@ -1,7 +1,6 @@
 package hashcash
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"strings"
 )
@@ -88,7 +87,10 @@ func (r *Response) Verify() error {
 	}
 
 	bits := r.Difficulty
-	hash := sha256.Sum256([]byte(r.String()))
+	hash, err := sumAlg(r.Alg, []byte(r.String()))
+	if err != nil {
+		return err
+	}
 	n := bits / 8
 	m := bits % 8
 	if m > 0 {
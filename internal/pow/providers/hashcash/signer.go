@@ -0,0 +1,106 @@
+package hashcash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSignature is returned by Verify in stateless mode when the
+// challenge was not signed by any known key.
+var ErrInvalidSignature = errors.New("invalid challenge signature")
+
+const (
+	nonceSep      = "."
+	minSigningKey = 16
+)
+
+// Signer makes challenges self-contained: instead of storing issued
+// challenges, the provider embeds an HMAC over the payload fields in the
+// nonce as `<kid>.<random>.<mac>`. Keys are looked up by kid, so retired
+// keys can stay in the set until the challenges signed with them expire.
+type Signer struct {
+	active string
+	keys   map[string][]byte
+}
+
+func NewSigner(active string, keys map[string][]byte) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one signing key is required")
+	}
+	for kid, key := range keys {
+		if kid == "" || strings.ContainsAny(kid, nonceSep+":") {
+			return nil, fmt.Errorf("invalid key id %q", kid)
+		}
+		if len(key) < minSigningKey {
+			return nil, fmt.Errorf("signing key %q must be at least %d bytes", kid, minSigningKey)
+		}
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q not found", active)
+	}
+
+	s := &Signer{
+		active: active,
+		keys:   make(map[string][]byte, len(keys)),
+	}
+	for kid, key := range keys {
+		s.keys[kid] = append([]byte(nil), key...)
+	}
+	return s, nil
+}
+
+// ActiveKey returns the id of the key used for signing new challenges.
+func (s *Signer) ActiveKey() string {
+	return s.active
+}
+
+// Sign sets p.Nonce to a fresh signed nonce.
+func (s *Signer) Sign(p *Payload) error {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	r := base64.RawURLEncoding.EncodeToString(random)
+
+	p.Nonce = strings.Join([]string{s.active, r, s.mac(s.keys[s.active], p, s.active, r)}, nonceSep)
+	return nil
+}
+
+// Verify checks that p.Nonce carries a valid signature over p.
+func (s *Signer) Verify(p *Payload) error {
+	parts := strings.Split(p.Nonce, nonceSep)
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: malformed nonce", ErrInvalidSignature)
+	}
+	kid, r, mac := parts[0], parts[1], parts[2]
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, kid)
+	}
+
+	if !hmac.Equal([]byte(mac), []byte(s.mac(key, p, kid, r))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s *Signer) mac(key []byte, p *Payload, kid, random string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(strings.Join([]string{
+		strconv.Itoa(p.Version),
+		strconv.Itoa(p.Difficulty),
+		strconv.FormatInt(p.ExpiresAt.Unix(), 10),
+		p.Subject,
+		p.Alg,
+		kid,
+		random,
+	}, ":")))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,129 @@
+package hashcash_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/pow/providers/hashcash"
+)
+
+func newTestSigner(t *testing.T, active string, kids ...string) *hashcash.Signer {
+	t.Helper()
+	keys := make(map[string][]byte, len(kids))
+	for _, kid := range kids {
+		keys[kid] = []byte("0123456789abcdef-" + kid)
+	}
+	s, err := hashcash.NewSigner(active, keys)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return s
+}
+
+func TestNewSigner_InvalidKeys(t *testing.T) {
+	if _, err := hashcash.NewSigner("k1", nil); err == nil {
+		t.Error("Expected error for empty key set")
+	}
+	if _, err := hashcash.NewSigner("k1", map[string][]byte{"k1": []byte("short")}); err == nil {
+		t.Error("Expected error for short key")
+	}
+	if _, err := hashcash.NewSigner("k.1", map[string][]byte{"k.1": []byte("0123456789abcdef")}); err == nil {
+		t.Error("Expected error for key id containing a separator")
+	}
+	if _, err := hashcash.NewSigner("k2", map[string][]byte{"k1": []byte("0123456789abcdef")}); err == nil {
+		t.Error("Expected error for missing active key")
+	}
+}
+
+func TestProvider_Stateless(t *testing.T) {
+	cache := &countingCache{ChallengeCache: hashcash.NewMemoryCache(time.Minute)}
+	provider := hashcash.NewProvider(
+		hashcash.WithSigner(newTestSigner(t, "k1", "k1")),
+		hashcash.WithCache(cache),
+	)
+
+	challenge, err := provider.Challenge("test_subject", 8)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	if cache.adds != 0 {
+		t.Errorf("Expected no cache writes on issuance, got %d", cache.adds)
+	}
+	if !strings.HasPrefix(strings.Split(challenge, ":")[4], "k1.") {
+		t.Errorf("Expected key id in nonce, got %s", challenge)
+	}
+
+	response, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	valid, err := provider.Verify(response)
+	if err != nil || !valid {
+		t.Fatalf("Expected valid response, got %v, %v", valid, err)
+	}
+
+	valid, err = provider.Verify(response)
+	if !errors.Is(err, hashcash.ErrReplay) || valid {
+		t.Errorf("Expected ErrReplay on second verification, got %v, %v", valid, err)
+	}
+}
+
+func TestProvider_Stateless_Tampered(t *testing.T) {
+	provider := hashcash.NewProvider(hashcash.WithSigner(newTestSigner(t, "k1", "k1")))
+
+	challenge, err := provider.Challenge("test_subject", 12)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+
+	ch, err := hashcash.ParseChallenge(challenge)
+	if err != nil {
+		t.Fatalf("Failed to parse challenge: %v", err)
+	}
+	ch.Difficulty = 4
+
+	response, err := hashcash.NewSolver().Solve(ch.String())
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	valid, err := provider.Verify(response)
+	if !errors.Is(err, hashcash.ErrInvalidSignature) || valid {
+		t.Errorf("Expected ErrInvalidSignature for lowered difficulty, got %v, %v", valid, err)
+	}
+}
+
+func TestProvider_Stateless_KeyRotation(t *testing.T) {
+	old := hashcash.NewProvider(hashcash.WithSigner(newTestSigner(t, "k1", "k1")))
+	rotated := hashcash.NewProvider(hashcash.WithSigner(newTestSigner(t, "k2", "k1", "k2")))
+	retired := hashcash.NewProvider(hashcash.WithSigner(newTestSigner(t, "k2", "k2")))
+
+	challenge, err := old.Challenge("test_subject", 8)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	response, err := hashcash.NewSolver().Solve(challenge)
+	if err != nil {
+		t.Fatalf("Failed to solve challenge: %v", err)
+	}
+
+	if valid, err := rotated.Verify(response); err != nil || !valid {
+		t.Errorf("Expected challenge signed with previous key to verify, got %v, %v", valid, err)
+	}
+	if valid, err := retired.Verify(response); !errors.Is(err, hashcash.ErrInvalidSignature) || valid {
+		t.Errorf("Expected ErrInvalidSignature for retired key, got %v, %v", valid, err)
+	}
+}
+
+type countingCache struct {
+	hashcash.ChallengeCache
+	adds int
+}
+
+func (c *countingCache) Add(fingerprint string, challenge string, expiration time.Duration) error {
+	c.adds++
+	return c.ChallengeCache.Add(fingerprint, challenge, expiration)
+}
@@ -1,27 +1,100 @@
 package hashcash
 
 import (
-	"crypto/sha256"
+	"context"
+	"encoding"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	ErrSolutionNotFound = errors.New("solution not found")
+	ErrChallengeExpired = errors.New("challenge expired before a solution was found")
+)
+
+// Progress is a snapshot of the solver's work so far.
+type Progress struct {
+	Hashes   uint64
+	Elapsed  time.Duration
+	Hashrate float64
+}
+
+type ProgressFunc func(p Progress)
+
 type Solver struct {
+	workers  int
+	progress ProgressFunc
+	interval time.Duration
 }
 
-func NewSolver() *Solver {
-	return &Solver{}
+type SolverOption func(*Solver)
+
+const (
+	defaultProgressInterval = time.Second
+	// progressBatch is how many hashes a worker tries between checking
+	// for cancellation and publishing its hash count.
+	progressBatch = 1 << 12
+	counterSize   = 8
+)
+
+// WithWorkers sets the number of goroutines searching the nonce space.
+// Defaults to the number of CPUs.
+func WithWorkers(n int) SolverOption {
+	return func(s *Solver) {
+		s.workers = n
+	}
+}
+
+// WithProgress registers fn to be called every interval while solving,
+// and once more when the search ends.
+func WithProgress(fn ProgressFunc, interval time.Duration) SolverOption {
+	return func(s *Solver) {
+		s.progress = fn
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+func NewSolver(opts ...SolverOption) *Solver {
+	s := &Solver{
+		workers:  runtime.NumCPU(),
+		interval: defaultProgressInterval,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.workers < 1 {
+		s.workers = 1
+	}
+
+	return s
 }
 
 func (s *Solver) Solve(challenge string) (string, error) {
+	return s.SolveContext(context.Background(), challenge)
+}
+
+// SolveContext searches for a solution until one is found, ctx is done or
+// the challenge expires, and returns the full response string.
+func (s *Solver) SolveContext(ctx context.Context, challenge string) (string, error) {
 	ch := &Challenge{}
 	if err := ch.FromString(challenge); err != nil {
 		return "", err
 	}
-	solution := s.solve(ch)
-	if "" == solution {
-		return "", fmt.Errorf("solution not found")
+	solution, err := s.solve(ctx, ch)
+	if err != nil {
+		return "", err
 	}
 
 	r := &Response{}
@@ -34,15 +107,93 @@ func (s *Solver) GetSolution(challenge string) (string, error) {
 	if err := ch.FromString(challenge); err != nil {
 		return "", err
 	}
-	solution := s.solve(ch)
-	if "" == solution {
-		return "", fmt.Errorf("solution not found")
+	return s.solve(context.Background(), ch)
+}
+
+type search struct {
+	newHash func() hash.Hash
+	prefix  []byte
+	state   []byte
+	bits    int
+	n       int
+	step    uint64
+	hashes  atomic.Uint64
+	found   chan string
+	cancel  context.CancelFunc
+}
+
+// midstate hashes prefix once and returns the marshaled digest state, so
+// that workers can restore it instead of rehashing the prefix on every
+// attempt. It returns nil if the hash does not support state marshaling.
+func midstate(newHash func() hash.Hash, prefix []byte) []byte {
+	h := newHash()
+	h.Write(prefix)
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil
+	}
+	if _, ok = h.(encoding.BinaryUnmarshaler); !ok {
+		return nil
 	}
-	return solution, nil
+	state, err := m.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// attempt holds the buffers a single worker reuses between tries, so the
+// hot loop does not allocate.
+type attempt struct {
+	h       hash.Hash
+	u       encoding.BinaryUnmarshaler
+	state   []byte
+	prefix  []byte
+	counter [counterSize]byte
+	enc     []byte
+	sum     []byte
 }
 
-func (s *Solver) solve(ch *Challenge) string {
-	chStr := ch.String()
+func (sr *search) newAttempt() *attempt {
+	a := &attempt{
+		h:      sr.newHash(),
+		state:  sr.state,
+		prefix: sr.prefix,
+		enc:    make([]byte, base64.RawURLEncoding.EncodedLen(counterSize)),
+	}
+	if a.state != nil {
+		a.u = a.h.(encoding.BinaryUnmarshaler)
+	}
+	a.sum = make([]byte, 0, a.h.Size())
+	return a
+}
+
+// try hashes the prefix followed by the encoded counter c and returns the
+// digest. The result is only valid until the next call.
+func (a *attempt) try(c uint64) []byte {
+	binary.LittleEndian.PutUint64(a.counter[:], c)
+	base64.RawURLEncoding.Encode(a.enc, a.counter[:])
+
+	if a.u != nil {
+		_ = a.u.UnmarshalBinary(a.state)
+	} else {
+		a.h.Reset()
+		a.h.Write(a.prefix)
+	}
+	a.h.Write(a.enc)
+	a.sum = a.h.Sum(a.sum[:0])
+	return a.sum
+}
+
+func (s *Solver) solve(ctx context.Context, ch *Challenge) (string, error) {
+	newHash, err := newHashFunc(ch.Alg)
+	if err != nil {
+		return "", err
+	}
+
+	solveCtx, cancel := context.WithDeadline(ctx, ch.ExpiresAt)
+	defer cancel()
+
 	bits := ch.Difficulty
 	n := bits / 8
 	m := bits % 8
@@ -50,20 +201,118 @@ func (s *Solver) solve(ch *Challenge) string {
 		n++
 	}
 
-	var result string
-	var solution uint32
-	sb := make([]byte, 4)
-	for {
-		binary.LittleEndian.PutUint32(sb, solution)
-		result = base64.RawURLEncoding.EncodeToString(sb)
-		hash := sha256.Sum256([]byte(chStr + ":" + result))
-		isValid, err := verifyBits(hash[:n], bits, n)
-		if err != nil {
-			continue
+	prefix := []byte(ch.String() + ":")
+	sr := &search{
+		newHash: newHash,
+		prefix:  prefix,
+		state:   midstate(newHash, prefix),
+		bits:    bits,
+		n:       n,
+		step:    uint64(s.workers),
+		found:   make(chan string, 1),
+		cancel:  cancel,
+	}
+
+	started := time.Now()
+	done := make(chan struct{})
+	reported := make(chan struct{})
+	if s.progress != nil {
+		go func() {
+			defer close(reported)
+			s.report(sr, started, done)
+		}()
+	} else {
+		close(reported)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func(start uint64) {
+			defer wg.Done()
+			sr.work(solveCtx, start)
+		}(uint64(w))
+	}
+	wg.Wait()
+	close(done)
+	<-reported
+
+	select {
+	case solution := <-sr.found:
+		return solution, nil
+	default:
+	}
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+	if solveCtx.Err() != nil {
+		return "", ErrChallengeExpired
+	}
+	return "", ErrSolutionNotFound
+}
+
+// work tries every step-th counter beginning at start, so that workers
+// partition the nonce space without coordination.
+func (sr *search) work(ctx context.Context, start uint64) {
+	a := sr.newAttempt()
+
+	var tried uint64
+	for c := start; ; c += sr.step {
+		sum := a.try(c)
+
+		if ok, err := verifyBits(sum[:sr.n], sr.bits, sr.n); err == nil && ok {
+			select {
+			case sr.found <- string(a.enc):
+			default:
+			}
+			sr.hashes.Add(tried + 1)
+			sr.cancel()
+			return
+		}
+
+		tried++
+		if tried == progressBatch {
+			sr.hashes.Add(tried)
+			tried = 0
+			if ctx.Err() != nil {
+				return
+			}
 		}
-		if isValid {
-			return result
+
+		if c > math.MaxUint64-sr.step {
+			sr.hashes.Add(tried)
+			return
+		}
+	}
+}
+
+func (s *Solver) report(sr *search, started time.Time, done <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			s.progress(snapshot(sr, started))
+			return
+		case <-ticker.C:
+			s.progress(snapshot(sr, started))
 		}
-		solution++
 	}
 }
+
+func snapshot(sr *search, started time.Time) Progress {
+	p := Progress{
+		Hashes:  sr.hashes.Load(),
+		Elapsed: time.Since(started),
+	}
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		p.Hashrate = float64(p.Hashes) / secs
+	}
+	return p
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("%d hashes in %s (%.0f H/s)", p.Hashes, p.Elapsed.Round(time.Millisecond), p.Hashrate)
+}
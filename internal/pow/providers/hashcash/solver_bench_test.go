@@ -0,0 +1,119 @@
+package hashcash
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func benchPrefix() []byte {
+	ch := &Challenge{
+		Payload: Payload{
+			Version:    1,
+			Difficulty: 24,
+			ExpiresAt:  time.Now().Add(defaultExpiry),
+			Subject:    base64.RawURLEncoding.EncodeToString([]byte("[2001:db8::1]:54321")),
+			Nonce:      "a3f9K2mQx7Lp0Vb8Zr1TnA",
+			Alg:        AlgSHA256,
+		},
+	}
+	return []byte(ch.String() + ":")
+}
+
+// BenchmarkAttempt_Naive reproduces the original hot loop: build the full
+// message as a string and hash it from scratch on every attempt.
+func BenchmarkAttempt_Naive(b *testing.B) {
+	chStr := string(benchPrefix())
+	chStr = chStr[:len(chStr)-1]
+	sb := make([]byte, 4)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		binary.LittleEndian.PutUint32(sb, uint32(i))
+		result := base64.RawURLEncoding.EncodeToString(sb)
+		hash := sha256.Sum256([]byte(chStr + ":" + result))
+		_, _ = verifyBits(hash[:3], 24, 3)
+	}
+}
+
+func BenchmarkAttempt_NoMidstate(b *testing.B) {
+	sr := &search{newHash: sha256.New, prefix: benchPrefix()}
+	a := sr.newAttempt()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sum := a.try(uint64(i))
+		_, _ = verifyBits(sum[:3], 24, 3)
+	}
+}
+
+func BenchmarkAttempt_Midstate(b *testing.B) {
+	prefix := benchPrefix()
+	sr := &search{newHash: sha256.New, prefix: prefix, state: midstate(sha256.New, prefix)}
+	a := sr.newAttempt()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sum := a.try(uint64(i))
+		_, _ = verifyBits(sum[:3], 24, 3)
+	}
+}
+
+func BenchmarkSolver_Solve(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			solver := NewSolver(WithWorkers(workers))
+			// Progress reports the running total of a solve; the last report,
+			// made before solve returns, is its final count.
+			var hashes, solved uint64
+			solver.progress = func(p Progress) { solved = p.Hashes }
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ch := &Challenge{
+					Payload: Payload{
+						Version:    1,
+						Difficulty: 16,
+						ExpiresAt:  time.Now().Add(defaultExpiry),
+						Subject:    "bench_subject",
+						Nonce:      strconv.Itoa(i),
+						Alg:        AlgSHA256,
+					},
+				}
+				if _, err := solver.solve(context.Background(), ch); err != nil {
+					b.Fatal(err)
+				}
+				hashes += solved
+			}
+			b.ReportMetric(float64(hashes)/b.Elapsed().Seconds(), "hashes/s")
+		})
+	}
+}
+
+func TestAttempt_MidstateMatchesFullHash(t *testing.T) {
+	prefix := benchPrefix()
+	plain := (&search{newHash: sha256.New, prefix: prefix}).newAttempt()
+	mid := (&search{newHash: sha256.New, prefix: prefix, state: midstate(sha256.New, prefix)}).newAttempt()
+
+	for _, c := range []uint64{0, 1, 1 << 32, 1<<64 - 1} {
+		want := sha256.Sum256(append(append([]byte{}, prefix...), base64.RawURLEncoding.EncodeToString(
+			binary.LittleEndian.AppendUint64(nil, c))...))
+		if got := plain.try(c); string(got) != string(want[:]) {
+			t.Errorf("counter %d: plain digest mismatch", c)
+		}
+		if got := mid.try(c); string(got) != string(want[:]) {
+			t.Errorf("counter %d: midstate digest mismatch", c)
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { mid.try(42) }); allocs != 0 {
+		t.Errorf("expected no allocations per attempt, got %v", allocs)
+	}
+}
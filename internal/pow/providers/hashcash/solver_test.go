@@ -1,8 +1,12 @@
 package hashcash_test
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
+
 	"wise-tcp/internal/pow/providers/hashcash"
 )
 
@@ -110,3 +114,117 @@ func TestSolver_SubjectWithColons(t *testing.T) {
 		t.Fatal("expected error when having colons in subject, but got nil")
 	}
 }
+
+func TestSolver_SolveContext_Workers(t *testing.T) {
+	solver := hashcash.NewSolver(hashcash.WithWorkers(4))
+
+	challenge := &hashcash.Challenge{
+		Payload: hashcash.Payload{
+			Version:    1,
+			Difficulty: 16,
+			ExpiresAt:  time.Now().Add(1 * time.Minute),
+			Subject:    "test_subject",
+			Nonce:      "test_nonce",
+			Alg:        "sha256",
+		},
+	}
+
+	solution, err := solver.SolveContext(context.Background(), challenge.String())
+	if err != nil {
+		t.Fatalf("failed to solve challenge: %v", err)
+	}
+
+	response := &hashcash.Response{}
+	if err = response.FromString(solution); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if err = response.Verify(); err != nil {
+		t.Fatalf("solver produced an invalid solution: %v", err)
+	}
+}
+
+func TestSolver_SolveContext_Cancel(t *testing.T) {
+	solver := hashcash.NewSolver(hashcash.WithWorkers(2))
+
+	challenge := &hashcash.Challenge{
+		Payload: hashcash.Payload{
+			Version:    1,
+			Difficulty: 52,
+			ExpiresAt:  time.Now().Add(1 * time.Minute),
+			Subject:    "test_subject",
+			Nonce:      "test_nonce",
+			Alg:        "sha256",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := solver.SolveContext(ctx, challenge.String())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("solver did not stop promptly after cancellation: %v", elapsed)
+	}
+}
+
+func TestSolver_SolveContext_Expired(t *testing.T) {
+	solver := hashcash.NewSolver(hashcash.WithWorkers(2))
+
+	challenge := &hashcash.Challenge{
+		Payload: hashcash.Payload{
+			Version:    1,
+			Difficulty: 52,
+			ExpiresAt:  time.Now().Add(1 * time.Second),
+			Subject:    "test_subject",
+			Nonce:      "test_nonce",
+			Alg:        "sha256",
+		},
+	}
+
+	_, err := solver.SolveContext(context.Background(), challenge.String())
+	if !errors.Is(err, hashcash.ErrChallengeExpired) {
+		t.Fatalf("expected ErrChallengeExpired, got %v", err)
+	}
+}
+
+func TestSolver_Progress(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reports []hashcash.Progress
+	)
+	solver := hashcash.NewSolver(
+		hashcash.WithWorkers(2),
+		hashcash.WithProgress(func(p hashcash.Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, p)
+		}, 10*time.Millisecond),
+	)
+
+	challenge := &hashcash.Challenge{
+		Payload: hashcash.Payload{
+			Version:    1,
+			Difficulty: 12,
+			ExpiresAt:  time.Now().Add(1 * time.Minute),
+			Subject:    "test_subject",
+			Nonce:      "test_nonce",
+			Alg:        "sha256",
+		},
+	}
+
+	if _, err := solver.Solve(challenge.String()); err != nil {
+		t.Fatalf("failed to solve challenge: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) == 0 {
+		t.Fatal("expected at least one progress report")
+	}
+	if last := reports[len(reports)-1]; last.Hashes == 0 {
+		t.Errorf("expected final report to count hashes, got %+v", last)
+	}
+}
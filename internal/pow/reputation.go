@@ -0,0 +1,175 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/pkg/core"
+	"wise-tcp/pkg/log"
+)
+
+type ReputationConfig struct {
+	Enabled bool `mapstructure:"enabled" envconfig:"POW_REPUTATION"`
+	// Backend is either "memory" or "redis"; redis uses pow.redis.
+	Backend  string        `mapstructure:"backend"`
+	HalfLife time.Duration `mapstructure:"halfLife"`
+	// PointsPerBit is the score that costs one extra difficulty bit.
+	PointsPerBit float64 `mapstructure:"pointsPerBit"`
+	MaxExtraBits int     `mapstructure:"maxExtraBits"`
+	// IPv6Prefix is the prefix length IPv6 clients are grouped by.
+	IPv6Prefix int `mapstructure:"ipv6Prefix"`
+}
+
+type ReputationEvent int
+
+const (
+	EventSolved ReputationEvent = iota
+	EventFailed
+	EventReplayed
+	EventProtoMismatch
+)
+
+const (
+	defaultHalfLife     = 10 * time.Minute
+	defaultPointsPerBit = 4
+	defaultMaxExtraBits = 6
+	defaultIPv6Prefix   = 64
+)
+
+// eventWeights are the score deltas applied per event. Solving a challenge
+// pays back some of the score earned by misbehaving.
+var eventWeights = map[ReputationEvent]float64{
+	EventSolved:        -1,
+	EventFailed:        2,
+	EventReplayed:      4,
+	EventProtoMismatch: 3,
+}
+
+func (e ReputationEvent) String() string {
+	switch e {
+	case EventSolved:
+		return "solved"
+	case EventFailed:
+		return "failed"
+	case EventReplayed:
+		return "replayed"
+	case EventProtoMismatch:
+		return "proto-mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// Reputation tracks client behavior per subject and converts the resulting
+// score into extra difficulty bits.
+type Reputation struct {
+	store        hashcash.ReputationStore
+	pointsPerBit float64
+	maxExtraBits int
+	ipv6Prefix   int
+}
+
+func NewReputation(store hashcash.ReputationStore, cfg ReputationConfig) *Reputation {
+	r := &Reputation{
+		store:        store,
+		pointsPerBit: cfg.PointsPerBit,
+		maxExtraBits: cfg.MaxExtraBits,
+		ipv6Prefix:   cfg.IPv6Prefix,
+	}
+	if r.pointsPerBit <= 0 {
+		r.pointsPerBit = defaultPointsPerBit
+	}
+	if r.maxExtraBits <= 0 {
+		r.maxExtraBits = defaultMaxExtraBits
+	}
+	if r.ipv6Prefix <= 0 || r.ipv6Prefix > 128 {
+		r.ipv6Prefix = defaultIPv6Prefix
+	}
+	return r
+}
+
+func newReputationStore(cfg Config) (hashcash.ReputationStore, error) {
+	halfLife := cfg.Reputation.HalfLife
+	if halfLife <= 0 {
+		halfLife = defaultHalfLife
+	}
+
+	switch cfg.Reputation.Backend {
+	case "", "memory":
+		return hashcash.NewMemoryReputation(halfLife, time.Minute), nil
+	case "redis":
+		return hashcash.NewRedisReputation(cfg.RedisAddr, halfLife), nil
+	default:
+		return nil, fmt.Errorf("unknown reputation backend %q", cfg.Reputation.Backend)
+	}
+}
+
+func (r *Reputation) Start(ctx context.Context) error {
+	return r.store.Start(ctx)
+}
+
+func (r *Reputation) Stop(ctx context.Context) error {
+	return r.store.Stop(ctx)
+}
+
+func (r *Reputation) CheckHealth(ctx context.Context) error {
+	return core.CheckHealth(ctx, r.store)
+}
+
+// Key maps a client address to the reputation key: the IP for IPv4 clients
+// and the configured prefix for IPv6 clients.
+func (r *Reputation) Key(addr string) string {
+	return hashcash.AddrKey(addr, r.ipv6Prefix)
+}
+
+func (r *Reputation) Record(addr string, ev ReputationEvent) {
+	key := r.Key(addr)
+	score, err := r.store.Add(key, eventWeights[ev])
+	if err != nil {
+		log.Errorf("Failed to record %s event for %s: %v", ev, key, err)
+		return
+	}
+	if ev != EventSolved {
+		log.Debugf("Reputation of %s is %.2f after %s event", key, score, ev)
+	}
+}
+
+// ExtraBits returns how many difficulty bits the client at addr pays on
+// top of the base difficulty.
+func (r *Reputation) ExtraBits(addr string) int {
+	score, err := r.store.Score(r.Key(addr))
+	if err != nil {
+		log.Errorf("Failed to read reputation: %v", err)
+		return 0
+	}
+	// The tolerance keeps a score that has barely started to decay from
+	// dropping a bit right after it was earned.
+	const tolerance = 1e-6
+	return min(int(math.Floor(score/r.pointsPerBit+tolerance)), r.maxExtraBits)
+}
+
+// classify maps the outcome of an authorization to a reputation event.
+// Outcomes that say nothing about the client, such as internal errors,
+// are not recorded. Neither are timeouts and cancellations: a slow
+// network or a server shutting down looks the same as a client giving up.
+func classify(err error) (ReputationEvent, bool) {
+	switch {
+	case err == nil:
+		return EventSolved, true
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return 0, false
+	case errors.Is(err, auth.ErrProtoMismatch):
+		return EventProtoMismatch, true
+	case errors.Is(err, hashcash.ErrReplay), errors.Is(err, hashcash.ErrSubjectMismatch):
+		return EventReplayed, true
+	case errors.Is(err, auth.ErrUnauthorized):
+		return EventFailed, true
+	default:
+		return 0, false
+	}
+}
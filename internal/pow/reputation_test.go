@@ -0,0 +1,127 @@
+package pow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/pow/providers/hashcash"
+)
+
+func newTestReputation(cfg ReputationConfig) *Reputation {
+	return NewReputation(hashcash.NewMemoryReputation(time.Hour, time.Hour), cfg)
+}
+
+func TestReputation_Key(t *testing.T) {
+	r := newTestReputation(ReputationConfig{})
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"192.0.2.1:5000", "192.0.2.1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"[::ffff:192.0.2.1]:5000", "192.0.2.1"},
+		{"[2001:db8:1:2:3:4:5:6]:5000", "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2:ffff::1]:6000", "2001:db8:1:2::/64"},
+		{"not-an-ip:5000", "not-an-ip"},
+	}
+
+	for _, tt := range tests {
+		if got := r.Key(tt.addr); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestReputation_ExtraBits(t *testing.T) {
+	r := newTestReputation(ReputationConfig{PointsPerBit: 2, MaxExtraBits: 3})
+	addr := "192.0.2.1:5000"
+
+	if bits := r.ExtraBits(addr); bits != 0 {
+		t.Fatalf("expected no extra bits for new client, got %d", bits)
+	}
+
+	r.Record(addr, EventFailed)
+	if bits := r.ExtraBits(addr); bits != 1 {
+		t.Errorf("expected 1 extra bit after a failure, got %d", bits)
+	}
+
+	r.Record("192.0.2.1:6000", EventReplayed)
+	if bits := r.ExtraBits(addr); bits != 3 {
+		t.Errorf("expected 3 extra bits after replay from same IP, got %d", bits)
+	}
+
+	for i := 0; i < 10; i++ {
+		r.Record(addr, EventProtoMismatch)
+	}
+	if bits := r.ExtraBits(addr); bits != 3 {
+		t.Errorf("expected extra bits capped at 3, got %d", bits)
+	}
+
+	if bits := r.ExtraBits("192.0.2.2:5000"); bits != 0 {
+		t.Errorf("expected other clients to keep base cost, got %d", bits)
+	}
+}
+
+func TestReputation_SolvedPaysBack(t *testing.T) {
+	r := newTestReputation(ReputationConfig{PointsPerBit: 2})
+	addr := "192.0.2.1:5000"
+
+	r.Record(addr, EventFailed)
+	r.Record(addr, EventSolved)
+	r.Record(addr, EventSolved)
+
+	if bits := r.ExtraBits(addr); bits != 0 {
+		t.Errorf("expected solved challenges to restore base cost, got %d", bits)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ReputationEvent
+		ok   bool
+	}{
+		{nil, EventSolved, true},
+		{auth.ErrProtoMismatch, EventProtoMismatch, true},
+		{fmt.Errorf("verification error: %w", hashcash.ErrReplay), EventReplayed, true},
+		{fmt.Errorf("%w: %w", auth.ErrUnauthorized, hashcash.ErrSubjectMismatch), EventReplayed, true},
+		{auth.ErrUnauthorized, EventFailed, true},
+		{context.DeadlineExceeded, 0, false},
+		{context.Canceled, 0, false},
+		{fmt.Errorf("%w: %w", auth.ErrUnauthorized, context.DeadlineExceeded), 0, false},
+		{errors.New("internal"), 0, false},
+	}
+
+	for _, tt := range tests {
+		ev, ok := classify(tt.err)
+		if ev != tt.want || ok != tt.ok {
+			t.Errorf("classify(%v) = %v, %v; want %v, %v", tt.err, ev, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAuth_SubjectDifficulty(t *testing.T) {
+	r := newTestReputation(ReputationConfig{PointsPerBit: 2, MaxExtraBits: 3})
+	a := NewAuth(hashcash.NewProvider(hashcash.WithDifficulty(48)), false, WithReputation(r))
+	addr := "192.0.2.1:5000"
+
+	if d := a.subjectDifficulty(addr, 0); d != 0 {
+		t.Errorf("expected provider default for new client, got %d", d)
+	}
+	if d := a.subjectDifficulty(addr, 2); d != 50 {
+		t.Errorf("expected 50 with extra bits, got %d", d)
+	}
+
+	r.Record("192.0.2.1:6000", EventReplayed)
+	if d := a.subjectDifficulty(addr, 0); d != 50 {
+		t.Errorf("expected 50 with reputation surcharge, got %d", d)
+	}
+	if d := a.subjectDifficulty(addr, 4); d != 52 {
+		t.Errorf("expected difficulty capped at 52, got %d", d)
+	}
+}
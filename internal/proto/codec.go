@@ -0,0 +1,157 @@
+package proto
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Codec reads and writes frames on a stream.
+type Codec struct {
+	r          *bufio.Reader
+	w          io.Writer
+	d          readDeadliner
+	maxPayload uint32
+	pending    []byte
+}
+
+type Option func(*Codec)
+
+func WithMaxPayload(n int) Option {
+	return func(c *Codec) {
+		if n > 0 {
+			c.maxPayload = uint32(n)
+		}
+	}
+}
+
+func NewCodec(rw io.ReadWriter, opts ...Option) *Codec {
+	c := &Codec{
+		r:          bufio.NewReader(rw),
+		w:          rw,
+		maxPayload: DefaultMaxPayload,
+	}
+	if d, ok := rw.(readDeadliner); ok {
+		c.d = d
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Codec) ReadMessage() (Message, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return Message{}, err
+	}
+
+	if header[0] != Version {
+		return Message{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header[0])
+	}
+	t := MessageType(header[1])
+	if !t.valid() {
+		return Message{}, fmt.Errorf("%w: %d", ErrUnknownType, header[1])
+	}
+	n := binary.BigEndian.Uint32(header[2:])
+	if n > c.maxPayload {
+		return Message{}, fmt.Errorf("%w: %d bytes, max %d", ErrFrameTooLarge, n, c.maxPayload)
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Type: t, Payload: payload}, nil
+}
+
+// WriteMessage writes m as a single frame with one Write call.
+func (c *Codec) WriteMessage(m Message) error {
+	if !m.Type.valid() {
+		return fmt.Errorf("%w: %d", ErrUnknownType, m.Type)
+	}
+	if uint64(len(m.Payload)) > uint64(c.maxPayload) {
+		return fmt.Errorf("%w: %d bytes, max %d", ErrFrameTooLarge, len(m.Payload), c.maxPayload)
+	}
+
+	buf := make([]byte, headerSize+len(m.Payload))
+	buf[0] = Version
+	buf[1] = byte(m.Type)
+	binary.BigEndian.PutUint32(buf[2:], uint32(len(m.Payload)))
+	copy(buf[headerSize:], m.Payload)
+
+	_, err := c.w.Write(buf)
+	return err
+}
+
+func (c *Codec) Write(t MessageType, payload []byte) error {
+	return c.WriteMessage(Message{Type: t, Payload: payload})
+}
+
+// Expect reads the next message and returns its payload if it has type t.
+// Error frames are returned as *RemoteError.
+func (c *Codec) Expect(t MessageType) ([]byte, error) {
+	m, err := c.ExpectOneOf(t)
+	if err != nil {
+		return nil, err
+	}
+	return m.Payload, nil
+}
+
+// ExpectOneOf reads the next message and returns it if it has one of the
+// given types. Error frames are returned as *RemoteError.
+func (c *Codec) ExpectOneOf(types ...MessageType) (Message, error) {
+	m, err := c.ReadMessage()
+	if err != nil {
+		return Message{}, err
+	}
+	if slices.Contains(types, m.Type) {
+		return m, nil
+	}
+	if m.Type == MsgError {
+		return Message{}, &RemoteError{Msg: string(m.Payload)}
+	}
+	return Message{}, fmt.Errorf("%w: got %s, want %v", ErrUnexpectedType, m.Type, types)
+}
+
+// ExpectOneOfContext is ExpectOneOf bounded by ctx, as LineReader.ReadLine
+// is.
+func (c *Codec) ExpectOneOfContext(ctx context.Context, types ...MessageType) (Message, error) {
+	return readContext(ctx, c.d, func() (Message, error) {
+		return c.ExpectOneOf(types...)
+	})
+}
+
+// Stream returns an io.ReadWriter over data frames: every Write is sent as
+// one data frame and Read returns the payloads of incoming data frames.
+func (c *Codec) Stream() io.ReadWriter {
+	return &stream{c: c}
+}
+
+type stream struct {
+	c *Codec
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	for len(s.c.pending) == 0 {
+		payload, err := s.c.Expect(MsgData)
+		if err != nil {
+			return 0, err
+		}
+		s.c.pending = payload
+	}
+	n := copy(p, s.c.pending)
+	s.c.pending = s.c.pending[n:]
+	return n, nil
+}
+
+func (s *stream) Write(p []byte) (int, error) {
+	if err := s.c.Write(MsgData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,139 @@
+package proto_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/proto"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	c := proto.NewCodec(&buf)
+
+	msgs := []proto.Message{
+		{Type: proto.MsgHello, Payload: []byte("1")},
+		{Type: proto.MsgChallenge, Payload: []byte("1:20:1700000000::nonce:sha256")},
+		{Type: proto.MsgData, Payload: []byte{}},
+	}
+	for _, m := range msgs {
+		if err := c.WriteMessage(m); err != nil {
+			t.Fatalf("Failed to write %s: %v", m.Type, err)
+		}
+	}
+
+	for _, want := range msgs {
+		got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", want.Type, err)
+		}
+		if got.Type != want.Type || !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("Expected %s %q, got %s %q", want.Type, want.Payload, got.Type, got.Payload)
+		}
+	}
+
+	if _, err := c.ReadMessage(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestCodec_ReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  error
+	}{
+		{"version", []byte{2, byte(proto.MsgHello), 0, 0, 0, 0}, proto.ErrUnsupportedVersion},
+		{"type", []byte{proto.Version, 42, 0, 0, 0, 0}, proto.ErrUnknownType},
+		{"size", []byte{proto.Version, byte(proto.MsgData), 0, 0, 0, 17}, proto.ErrFrameTooLarge},
+		{"truncated", []byte{proto.Version, byte(proto.MsgData), 0, 0, 0, 4, 'a'}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := proto.NewCodec(bytes.NewBuffer(tt.frame), proto.WithMaxPayload(16))
+			if _, err := c.ReadMessage(); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCodec_WriteTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	c := proto.NewCodec(&buf, proto.WithMaxPayload(4))
+
+	if err := c.Write(proto.MsgData, []byte("12345")); !errors.Is(err, proto.ErrFrameTooLarge) {
+		t.Errorf("Expected ErrFrameTooLarge, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written, got %d bytes", buf.Len())
+	}
+}
+
+func TestCodec_Expect(t *testing.T) {
+	var buf bytes.Buffer
+	c := proto.NewCodec(&buf)
+
+	_ = c.Write(proto.MsgError, []byte("unauthorized"))
+	_, err := c.Expect(proto.MsgData)
+	var remote *proto.RemoteError
+	if !errors.As(err, &remote) || remote.Msg != "unauthorized" {
+		t.Errorf("Expected remote error, got %v", err)
+	}
+
+	_ = c.Write(proto.MsgChallenge, nil)
+	if _, err = c.Expect(proto.MsgData); !errors.Is(err, proto.ErrUnexpectedType) {
+		t.Errorf("Expected ErrUnexpectedType, got %v", err)
+	}
+}
+
+func TestCodec_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	s := proto.NewCodec(&buf).Stream()
+
+	if _, err := s.Write([]byte("hello ")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if _, err := s.Write([]byte("world")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	got, err := io.ReadAll(s)
+	if err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("Expected %q, got %q", "hello world", got)
+	}
+}
+
+func TestCodec_ExpectOneOfContext(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	c := proto.NewCodec(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.ExpectOneOfContext(ctx, proto.MsgResponse); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+
+	// Nothing is left reading in the background: the next frame goes to
+	// the next read.
+	go func() {
+		_ = proto.NewCodec(client).Write(proto.MsgResponse, []byte("solution"))
+	}()
+	got, err := c.ExpectOneOfContext(context.Background(), proto.MsgResponse)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if string(got.Payload) != "solution" {
+		t.Errorf("Expected %q, got %q", "solution", got.Payload)
+	}
+}
@@ -0,0 +1,68 @@
+package proto
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// readDeadlineGetter is implemented by connections that report the read
+// deadline set on them, so that a read bounded by a context can put it
+// back.
+type readDeadlineGetter interface {
+	ReadDeadline() time.Time
+}
+
+// readContext runs read bounded by ctx. If d is not nil, the read deadline
+// is set to the deadline of ctx and moved into the past as soon as ctx is
+// cancelled, so that a blocked read returns and no goroutine is left
+// behind. On return the read deadline is restored if d reports it, and
+// cleared otherwise. Without d, ctx is only checked before reading.
+func readContext[T any](ctx context.Context, d readDeadliner, read func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	if d != nil {
+		var outer time.Time
+		if g, ok := d.(readDeadlineGetter); ok {
+			outer = g.ReadDeadline()
+		}
+		dl, _ := ctx.Deadline()
+		if dl.IsZero() || !outer.IsZero() && outer.Before(dl) {
+			dl = outer
+		}
+		if err := d.SetReadDeadline(dl); err != nil {
+			return zero, fmt.Errorf("failed to set read deadline: %w", err)
+		}
+		cancelled := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			// A deadline in the past makes the blocked Read return at once.
+			_ = d.SetReadDeadline(time.Unix(1, 0))
+			close(cancelled)
+		})
+		defer func() {
+			if !stop() {
+				<-cancelled
+			}
+			_ = d.SetReadDeadline(outer)
+		}()
+	}
+
+	v, err := read()
+	if err != nil {
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		// The read deadline may fire just before ctx notices its own.
+		if dl, ok := ctx.Deadline(); ok && !time.Now().Before(dl) {
+			return zero, context.DeadlineExceeded
+		}
+	}
+	return v, err
+}
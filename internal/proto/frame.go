@@ -0,0 +1,77 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Version is the binary protocol version written in every frame header.
+const Version = 1
+
+// A frame is a fixed header followed by the payload:
+//
+//	+---------+------+-------------------+-----------+
+//	| version | type | length (uint32 BE) | payload  |
+//	+---------+------+-------------------+-----------+
+//	  1 byte   1 byte       4 bytes        length bytes
+const headerSize = 6
+
+const DefaultMaxPayload = 64 << 10
+
+type MessageType uint8
+
+const (
+	MsgHello MessageType = iota + 1
+	MsgChallenge
+	MsgResponse
+	MsgError
+	MsgData
+	MsgRequest
+	MsgToken
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	ErrUnknownType        = errors.New("unknown message type")
+	ErrFrameTooLarge      = errors.New("frame too large")
+	ErrUnexpectedType     = errors.New("unexpected message type")
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgHello:
+		return "hello"
+	case MsgChallenge:
+		return "challenge"
+	case MsgResponse:
+		return "response"
+	case MsgError:
+		return "error"
+	case MsgData:
+		return "data"
+	case MsgRequest:
+		return "request"
+	case MsgToken:
+		return "token"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+func (t MessageType) valid() bool {
+	return t >= MsgHello && t <= MsgToken
+}
+
+type Message struct {
+	Type    MessageType
+	Payload []byte
+}
+
+// RemoteError is an error reported by the peer in an error frame.
+type RemoteError struct {
+	Msg string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Msg
+}
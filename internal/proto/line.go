@@ -0,0 +1,92 @@
+package proto
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultMaxLine is the default maximum length of a text protocol line,
+// excluding the line terminator.
+const DefaultMaxLine = 1024
+
+var ErrLineTooLong = errors.New("line too long")
+
+// LineReader reads newline-terminated messages of the text protocol. A
+// message may arrive in any number of segments; lines longer than the
+// maximum are rejected with ErrLineTooLong instead of being truncated.
+type LineReader struct {
+	r   *bufio.Reader
+	d   readDeadliner
+	max int
+}
+
+func NewLineReader(r io.Reader, max int) *LineReader {
+	if max <= 0 {
+		max = DefaultMaxLine
+	}
+	lr := &LineReader{
+		r:   bufio.NewReader(r),
+		max: max,
+	}
+	if d, ok := r.(readDeadliner); ok {
+		lr.d = d
+	}
+	return lr
+}
+
+// ReadLine returns the next line without the trailing "\n" or "\r\n". A
+// final line terminated by EOF instead of a newline is returned as is.
+//
+// If the underlying reader supports read deadlines, the read is bounded by
+// the deadline of ctx and unblocked as soon as ctx is cancelled, so no
+// goroutine is left behind. A read deadline set earlier still applies and
+// is restored on return if the reader reports it through a ReadDeadline
+// method; otherwise it is cleared. Without deadline support ctx is only
+// checked before reading.
+func (lr *LineReader) ReadLine(ctx context.Context) (string, error) {
+	return lr.ReadLineMax(ctx, lr.max)
+}
+
+// ReadLineMax is ReadLine with a different maximum line length, for
+// messages with a limit of their own.
+func (lr *LineReader) ReadLineMax(ctx context.Context, max int) (string, error) {
+	if max <= 0 {
+		max = lr.max
+	}
+	return readContext(ctx, lr.d, func() (string, error) {
+		return lr.readLine(max)
+	})
+}
+
+func (lr *LineReader) readLine(max int) (string, error) {
+	var sb strings.Builder
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		if sb.Len()+len(chunk) > max+len("\r\n") {
+			return "", fmt.Errorf("%w: more than %d bytes", ErrLineTooLong, max)
+		}
+		sb.Write(chunk)
+
+		switch {
+		case err == nil:
+			line := strings.TrimSuffix(strings.TrimSuffix(sb.String(), "\n"), "\r")
+			if len(line) > max {
+				return "", fmt.Errorf("%w: more than %d bytes", ErrLineTooLong, max)
+			}
+			return line, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && sb.Len() > 0:
+			if sb.Len() > max {
+				return "", fmt.Errorf("%w: more than %d bytes", ErrLineTooLong, max)
+			}
+			return sb.String(), nil
+		default:
+			return "", err
+		}
+	}
+}
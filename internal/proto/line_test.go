@@ -0,0 +1,187 @@
+package proto_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"wise-tcp/internal/proto"
+)
+
+func TestLineReader_ReadLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"single", "X-Response: abc\n", []string{"X-Response: abc"}},
+		{"crlf", "X-Response: abc\r\n", []string{"X-Response: abc"}},
+		{"eof", "X-Response: abc", []string{"X-Response: abc"}},
+		{"multiple", "a\nb\n", []string{"a", "b"}},
+		{"exact max", strings.Repeat("x", 32) + "\n", []string{strings.Repeat("x", 32)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// OneByteReader splits the input as if it arrived one byte per segment.
+			lr := proto.NewLineReader(iotest.OneByteReader(strings.NewReader(tt.input)), 32)
+			for _, want := range tt.want {
+				got, err := lr.ReadLine(context.Background())
+				if err != nil {
+					t.Fatalf("Failed to read line: %v", err)
+				}
+				if got != want {
+					t.Errorf("Expected %q, got %q", want, got)
+				}
+			}
+			if _, err := lr.ReadLine(context.Background()); !errors.Is(err, io.EOF) {
+				t.Errorf("Expected EOF, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLineReader_TooLong(t *testing.T) {
+	for _, input := range []string{
+		strings.Repeat("x", 33) + "\n",
+		strings.Repeat("x", 33),
+		strings.Repeat("x", 10000) + "\n",
+	} {
+		lr := proto.NewLineReader(strings.NewReader(input), 32)
+		if _, err := lr.ReadLine(context.Background()); !errors.Is(err, proto.ErrLineTooLong) {
+			t.Errorf("Expected ErrLineTooLong for %d bytes, got %v", len(input), err)
+		}
+	}
+}
+
+func TestLineReader_Deadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := proto.NewLineReader(server, 0).ReadLine(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestLineReader_Cancel(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := proto.NewLineReader(server, 0).ReadLine(ctx)
+		done <- err
+	}()
+
+	// Part of a line arrives, then the caller gives up.
+	if _, err := client.Write([]byte("X-Resp")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReadLine did not return after cancel")
+	}
+}
+
+func TestLineReader_ClearsDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("X-Response: abc\n"))
+		time.Sleep(100 * time.Millisecond)
+		_, _ = client.Write([]byte("X-Request: quote\n"))
+	}()
+
+	lr := proto.NewLineReader(server, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := lr.ReadLine(ctx); err != nil {
+		t.Fatalf("Failed to read line: %v", err)
+	}
+
+	// The deadline of the line does not cut off later reads of the
+	// connection.
+	buf := make([]byte, len("X-Request: quote\n"))
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+}
+
+// deadlineConn reports the read deadline set on it.
+type deadlineConn struct {
+	net.Conn
+	readDL time.Time
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.readDL = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *deadlineConn) ReadDeadline() time.Time {
+	return c.readDL
+}
+
+func TestLineReader_RestoresDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("X-Response: abc\n"))
+	}()
+
+	conn := &deadlineConn{Conn: server}
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("Failed to set deadline: %v", err)
+	}
+	lr := proto.NewLineReader(conn, 0)
+	if _, err := lr.ReadLine(context.Background()); err != nil {
+		t.Fatalf("Failed to read line: %v", err)
+	}
+
+	// The deadline set before the line still cuts off later reads.
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Outer deadline did not fire after ReadLine")
+	}
+}
+
+func TestLineReader_ReadLineMax(t *testing.T) {
+	lr := proto.NewLineReader(strings.NewReader(strings.Repeat("x", 16)+"\n"+strings.Repeat("x", 16)+"\n"), 32)
+	if _, err := lr.ReadLineMax(context.Background(), 8); !errors.Is(err, proto.ErrLineTooLong) {
+		t.Errorf("Expected ErrLineTooLong, got %v", err)
+	}
+	if _, err := lr.ReadLine(context.Background()); err != nil {
+		t.Errorf("Expected line within the reader maximum, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package proxyproto
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"wise-tcp/pkg/log"
+)
+
+// Listener accepts connections whose first bytes are a PROXY protocol
+// header when they come from a trusted source. Connections from other
+// sources are passed through untouched, so clients cannot spoof their
+// address.
+type Listener struct {
+	net.Listener
+	trusted []netip.Prefix
+}
+
+// NewListener wraps ln. trusted lists the networks of the proxies allowed
+// to send a header.
+func NewListener(ln net.Listener, trusted []netip.Prefix) *Listener {
+	return &Listener{Listener: ln, trusted: trusted}
+}
+
+// ParseTrusted parses a list of CIDRs; plain addresses are accepted as
+// single-host networks.
+func ParseTrusted(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(cidr)
+			if aerr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip := tcp.AddrPort().Addr().Unmap()
+	for _, p := range l.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection from a trusted proxy. The header is read on the
+// first call to Read or RemoteAddr, so that Accept never blocks on a slow
+// proxy and the connection deadline applies to the header as well.
+type Conn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.remote, c.err = readHeader(c.r)
+		if c.err != nil {
+			log.Warnf("Failed to read PROXY header from %s: %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the client address from the header, or the address
+// of the proxy if the header does not carry one or could not be read.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+// ProxyAddr returns the address of the proxy the connection came through.
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
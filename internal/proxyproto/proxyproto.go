@@ -0,0 +1,158 @@
+// Package proxyproto implements the receiving side of the PROXY protocol
+// (versions 1 and 2) as used by HAProxy and cloud load balancers to pass
+// on the address of the original client.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMissingHeader = errors.New("missing PROXY protocol header")
+	ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+)
+
+const (
+	v1Prefix = "PROXY "
+	// v1MaxLen is the longest possible v1 header including CRLF.
+	v1MaxLen = 107
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v2HeaderLen = 16
+	v2CmdLocal  = 0x0
+	v2CmdProxy  = 0x1
+	v2FamTCP4   = 0x11
+	v2FamTCP6   = 0x21
+)
+
+// readHeader reads a v1 or v2 header from r and returns the source address
+// it carries, or nil if the header does not carry one (v1 UNKNOWN, v2
+// LOCAL or an unsupported address family).
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case v2Signature[0]:
+		sig, err := r.Peek(len(v2Signature))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(sig, v2Signature) {
+			return nil, ErrMissingHeader
+		}
+		return readV2(r)
+	case v1Prefix[0]:
+		prefix, err := r.Peek(len(v1Prefix))
+		if err != nil {
+			return nil, err
+		}
+		if string(prefix) != v1Prefix {
+			return nil, ErrMissingHeader
+		}
+		return readV1(r)
+	default:
+		return nil, ErrMissingHeader
+	}
+}
+
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header not terminated", ErrInvalidHeader)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("%w: unknown protocol %q", ErrInvalidHeader, fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil || ip.Is4() != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("%w: bad source address %q", ErrInvalidHeader, fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad source port %q", ErrInvalidHeader, fields[4])
+	}
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [v2HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	verCmd, fam := hdr[12], hdr[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: version %d", ErrInvalidHeader, verCmd>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	switch verCmd & 0xf {
+	case v2CmdLocal:
+		return nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("%w: command %d", ErrInvalidHeader, verCmd&0xf)
+	}
+
+	var ipLen int
+	switch fam {
+	case v2FamTCP4:
+		ipLen = 4
+	case v2FamTCP6:
+		ipLen = 16
+	default:
+		// UDP and Unix sockets carry no address a TCP server can use.
+		return nil, nil
+	}
+	// Source and destination address followed by source and destination
+	// port; TLVs may follow.
+	if len(body) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: address block too short", ErrInvalidHeader)
+	}
+	ip, _ := netip.AddrFromSlice(body[:ipLen])
+	port := binary.BigEndian.Uint16(body[2*ipLen:])
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+}
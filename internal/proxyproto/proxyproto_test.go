@@ -0,0 +1,166 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func v2Addrs(src, dst netip.AddrPort, tlvs ...byte) []byte {
+	var b []byte
+	b = append(b, src.Addr().AsSlice()...)
+	b = append(b, dst.Addr().AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	b = binary.BigEndian.AppendUint16(b, dst.Port())
+	return append(b, tlvs...)
+}
+
+func TestReadHeader(t *testing.T) {
+	src4 := netip.MustParseAddrPort("192.0.2.1:5000")
+	dst4 := netip.MustParseAddrPort("10.0.0.1:9001")
+	src6 := netip.MustParseAddrPort("[2001:db8::1]:5000")
+	dst6 := netip.MustParseAddrPort("[2001:db8::2]:9001")
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+		err    error
+	}{
+		{"v1 tcp4", "PROXY TCP4 192.0.2.1 10.0.0.1 5000 9001\r\n", "192.0.2.1:5000", nil},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 5000 9001\r\n", "[2001:db8::1]:5000", nil},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", nil},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::1 2001:db8::2 5000 9001\r\n", "", ErrInvalidHeader},
+		{"v1 bad port", "PROXY TCP4 192.0.2.1 10.0.0.1 http 9001\r\n", "", ErrInvalidHeader},
+		{"v1 no crlf", "PROXY TCP4 192.0.2.1 10.0.0.1 5000 9001\n", "", ErrInvalidHeader},
+		{"v1 too long", "PROXY " + strings.Repeat("x", 200) + "\r\n", "", ErrInvalidHeader},
+		{"v2 tcp4", string(v2Header(v2CmdProxy, v2FamTCP4, v2Addrs(src4, dst4))), "192.0.2.1:5000", nil},
+		{"v2 tcp6", string(v2Header(v2CmdProxy, v2FamTCP6, v2Addrs(src6, dst6))), "[2001:db8::1]:5000", nil},
+		{"v2 tlvs", string(v2Header(v2CmdProxy, v2FamTCP4, v2Addrs(src4, dst4, 0x04, 0, 1, 'x'))), "192.0.2.1:5000", nil},
+		{"v2 local", string(v2Header(v2CmdLocal, 0, nil)), "", nil},
+		{"v2 short", string(v2Header(v2CmdProxy, v2FamTCP6, v2Addrs(src4, dst4))), "", ErrInvalidHeader},
+		{"missing", "X-Response: 1:20\n", "", ErrMissingHeader},
+		{"truncated", "PROXY TCP4 192.0.2.1", "", io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.header + "payload"))
+			addr, err := readHeader(r)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read header: %v", err)
+			}
+
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("Expected address %q, got %q", tt.want, got)
+			}
+
+			rest, _ := io.ReadAll(r)
+			if string(rest) != "payload" {
+				t.Errorf("Expected payload after header, got %q", rest)
+			}
+		})
+	}
+}
+
+func TestParseTrusted(t *testing.T) {
+	prefixes, err := ParseTrusted([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(prefixes) != 3 || prefixes[1].Bits() != 32 {
+		t.Errorf("Unexpected prefixes %v", prefixes)
+	}
+
+	if _, err = ParseTrusted([]string{"not-a-cidr"}); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted string
+		want    string
+		data    string
+	}{
+		{"trusted", "127.0.0.0/8", "192.0.2.1:5000", "hello"},
+		{"untrusted", "10.0.0.0/8", "127.0.0.1", "PROXY TCP4 192.0.2.1 10.0.0.1 5000 9001\r\nhello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trusted, _ := ParseTrusted([]string{tt.trusted})
+			raw, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln := NewListener(raw, trusted)
+			defer ln.Close()
+
+			go func() {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = conn.Write([]byte("PROXY TCP4 192.0.2.1 10.0.0.1 5000 9001\r\nhello"))
+				time.Sleep(100 * time.Millisecond)
+			}()
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+			if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("Expected remote address %s, got %s", tt.want, got)
+			}
+			data := make([]byte, len(tt.data))
+			if _, err = io.ReadFull(conn, data); err != nil {
+				t.Fatalf("Failed to read data: %v", err)
+			}
+			if string(data) != tt.data {
+				t.Errorf("Expected data %q, got %q", tt.data, data)
+			}
+		})
+	}
+}
+
+func TestConn_MissingHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := &Conn{Conn: server, r: bufio.NewReader(server)}
+	go func() { _, _ = client.Write([]byte("X-Response: 1:20\n")) }()
+
+	if _, err := c.Read(make([]byte, 16)); !errors.Is(err, ErrMissingHeader) {
+		t.Errorf("Expected ErrMissingHeader, got %v", err)
+	}
+	if c.RemoteAddr() != server.RemoteAddr() {
+		t.Errorf("Expected proxy address, got %v", c.RemoteAddr())
+	}
+}
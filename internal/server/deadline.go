@@ -0,0 +1,269 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DeadlineConfig splits the time a connection may take into phases, so
+// that a client cannot spend the whole server timeout in one of them. A
+// zero duration leaves the phase bounded by the server timeout only, which
+// still caps the whole exchange.
+type DeadlineConfig struct {
+	// Handshake bounds the PROXY protocol header, the TLS handshake and
+	// sending the challenge, not counting the wait for a throttle slot.
+	// Clients that send their response unasked must start within it.
+	Handshake time.Duration `mapstructure:"handshake"`
+	// Solve is the time the client has between the challenge and the
+	// first byte of its response.
+	Solve time.Duration `mapstructure:"solve"`
+	// Read bounds reading the rest of a message once its first byte has
+	// arrived.
+	Read time.Duration `mapstructure:"read"`
+	// Write bounds the request handler writing its reply.
+	Write time.Duration `mapstructure:"write"`
+	// MinRate is the lowest rate, in bytes per second, at which a client
+	// may send a message once it has started; slower clients are
+	// disconnected. RateGrace is the head start before the rate counts.
+	MinRate   int           `mapstructure:"minRate" env:"MIN_BYTE_RATE"`
+	RateGrace time.Duration `mapstructure:"rateGrace"`
+}
+
+const defaultRateGrace = time.Second
+
+// ErrTooSlow is returned by reads from a client sending below the minimum
+// byte rate.
+var ErrTooSlow = errors.New("client is sending too slowly")
+
+func (c DeadlineConfig) enabled() bool {
+	return c.Handshake > 0 || c.Solve > 0 || c.Read > 0 || c.Write > 0 || c.MinRate > 0
+}
+
+// handshake returns the deadline for the handshake phase starting now,
+// which is no later than limit.
+func (c DeadlineConfig) handshake(limit time.Time) time.Time {
+	return earliest(limit, after(time.Now(), c.Handshake))
+}
+
+type phase int
+
+const (
+	phaseHandshake phase = iota
+	phaseSolve
+	phaseRead
+	phaseWrite
+)
+
+// deadlineConn applies the phase deadlines and the minimum byte rate to a
+// connection. Deadlines set by its users still apply; whichever comes
+// first wins.
+//
+// The phases follow the exchange: the handshake lasts until a challenge is
+// sent, which starts the solve phase. Any read that returns data outside
+// the read phase starts it, and the handler starts the write phase before
+// writing its reply.
+type deadlineConn struct {
+	net.Conn
+	cfg DeadlineConfig
+
+	mu    sync.Mutex
+	phase phase
+	// Deadlines set through SetDeadline and friends.
+	readDL, writeDL time.Time
+	// Deadlines of the current phase; zero if it sets none.
+	phaseReadDL, phaseWriteDL time.Time
+	// Bytes read since the read phase started at since.
+	since time.Time
+	read  int64
+}
+
+// newDeadlineConn wraps conn and starts the handshake phase. limit is the
+// deadline of the whole exchange.
+func newDeadlineConn(conn net.Conn, cfg DeadlineConfig, limit time.Time) (*deadlineConn, error) {
+	if cfg.MinRate > 0 && cfg.RateGrace <= 0 {
+		cfg.RateGrace = defaultRateGrace
+	}
+	c := &deadlineConn{
+		Conn:    conn,
+		cfg:     cfg,
+		readDL:  limit,
+		writeDL: limit,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hs := after(time.Now(), cfg.Handshake)
+	c.phaseReadDL, c.phaseWriteDL = hs, hs
+	if err := c.applyLocked(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	dl, rateDL := c.readDeadlineLocked()
+	err := c.Conn.SetReadDeadline(dl)
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n > 0 {
+		if c.phase != phaseRead {
+			c.phase = phaseRead
+			c.since, c.read = time.Now(), 0
+			c.phaseReadDL = after(c.since, c.cfg.Read)
+			// A write deadline left over from an earlier phase must not cut
+			// short the answer to this message.
+			c.phaseWriteDL = time.Time{}
+			if aerr := c.applyLocked(); aerr != nil && err == nil {
+				err = aerr
+			}
+		}
+		c.read += int64(n)
+	}
+	var ne net.Error
+	if err != nil && !rateDL.IsZero() && errors.As(err, &ne) && ne.Timeout() && !time.Now().Before(rateDL) {
+		return n, ErrTooSlow
+	}
+	return n, err
+}
+
+// ChallengeSent starts the solve phase.
+func (c *deadlineConn) ChallengeSent() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.phase = phaseSolve
+	solve := after(time.Now(), c.cfg.Solve)
+	c.phaseReadDL, c.phaseWriteDL = solve, solve
+	_ = c.applyLocked()
+}
+
+// startWrite starts the write phase, in which only the time the reply takes
+// to write is bounded.
+func (c *deadlineConn) startWrite() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.phase = phaseWrite
+	c.phaseReadDL = time.Time{}
+	c.phaseWriteDL = after(time.Now(), c.cfg.Write)
+	return c.applyLocked()
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDL, c.writeDL = t, t
+	return c.applyLocked()
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDL = t
+	dl, _ := c.readDeadlineLocked()
+	return c.Conn.SetReadDeadline(dl)
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeDL = t
+	return c.Conn.SetWriteDeadline(earliest(c.writeDL, c.phaseWriteDL))
+}
+
+// ReadDeadline returns the read deadline last set by the users of c, so
+// that reads bounded by a context can restore it.
+func (c *deadlineConn) ReadDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.readDL
+}
+
+func (c *deadlineConn) applyLocked() error {
+	dl, _ := c.readDeadlineLocked()
+	if err := c.Conn.SetReadDeadline(dl); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(earliest(c.writeDL, c.phaseWriteDL))
+}
+
+// readDeadlineLocked returns the read deadline to apply and, if the byte
+// rate is being enforced, the time by which the next byte has to arrive.
+func (c *deadlineConn) readDeadlineLocked() (dl, rateDL time.Time) {
+	dl = earliest(c.readDL, c.phaseReadDL)
+	if c.cfg.MinRate <= 0 || c.phase != phaseRead {
+		return dl, time.Time{}
+	}
+	rateDL = c.since.Add(c.cfg.RateGrace + time.Duration(c.read+1)*time.Second/time.Duration(c.cfg.MinRate))
+	return earliest(dl, rateDL), rateDL
+}
+
+// trackedConn remembers the read deadline set on a connection without
+// phase deadlines, so that reads bounded by a context can restore it.
+type trackedConn struct {
+	net.Conn
+
+	mu     sync.Mutex
+	readDL time.Time
+}
+
+func (c *trackedConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDL = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *trackedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDL = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// ReadDeadline returns the read deadline last set on c.
+func (c *trackedConn) ReadDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.readDL
+}
+
+// after returns the time d after t, or the zero time if d is not positive.
+func after(t time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return t.Add(d)
+}
+
+// earliest returns the earlier of two deadlines, where the zero time means
+// no deadline.
+func earliest(a, b time.Time) time.Time {
+	switch {
+	case a.IsZero():
+		return b
+	case b.IsZero(), a.Before(b):
+		return a
+	default:
+		return b
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/proto"
+)
+
+func newTestDeadlineConn(t *testing.T, cfg DeadlineConfig) (*deadlineConn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	dc, err := newDeadlineConn(server, cfg, time.Now().Add(5*time.Second))
+	if err != nil {
+		t.Fatalf("Failed to wrap connection: %v", err)
+	}
+	return dc, client
+}
+
+func TestDeadlineConn_Phases(t *testing.T) {
+	dc, client := newTestDeadlineConn(t, DeadlineConfig{
+		Handshake: time.Second,
+		Solve:     30 * time.Millisecond,
+		Read:      time.Second,
+	})
+
+	// The handshake leaves time to send the challenge...
+	go func() { _, _ = client.Read(make([]byte, 64)) }()
+	if _, err := dc.Write([]byte("X-Challenge: c\n")); err != nil {
+		t.Fatalf("Failed to write challenge: %v", err)
+	}
+	dc.ChallengeSent()
+
+	// ...but the solve window is short.
+	start := time.Now()
+	_, err := dc.Read(make([]byte, 64))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected solve deadline to expire, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected solve deadline of 30ms, took %v", elapsed)
+	}
+}
+
+func TestDeadlineConn_ReadPhase(t *testing.T) {
+	dc, client := newTestDeadlineConn(t, DeadlineConfig{Solve: 30 * time.Millisecond})
+	dc.ChallengeSent()
+
+	go func() {
+		_, _ = client.Write([]byte("X-Resp"))
+		time.Sleep(60 * time.Millisecond)
+		_, _ = client.Write([]byte("onse: s\n"))
+	}()
+
+	// The first byte ends the solve phase; Read is not limited.
+	buf := make([]byte, 64)
+	for _, want := range []string{"X-Resp", "onse: s\n"} {
+		n, err := dc.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestDeadlineConn_MinRate(t *testing.T) {
+	dc, client := newTestDeadlineConn(t, DeadlineConfig{MinRate: 100, RateGrace: 20 * time.Millisecond})
+
+	go func() { _, _ = client.Write([]byte("X")) }()
+	if _, err := dc.Read(make([]byte, 64)); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	// One byte per 10ms is due after a grace of 20ms.
+	start := time.Now()
+	_, err := dc.Read(make([]byte, 64))
+	if !errors.Is(err, ErrTooSlow) {
+		t.Fatalf("Expected ErrTooSlow, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected trickling client to be cut off early, took %v", elapsed)
+	}
+}
+
+func TestDeadlineConn_UserDeadline(t *testing.T) {
+	dc, _ := newTestDeadlineConn(t, DeadlineConfig{Handshake: time.Second, MinRate: 1})
+
+	// A deadline set by the user is not mistaken for a slow client, and
+	// startWrite does not lift it.
+	if err := dc.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("Failed to set deadline: %v", err)
+	}
+	if err := dc.startWrite(); err != nil {
+		t.Fatalf("Failed to start write phase: %v", err)
+	}
+	if _, err := dc.Read(make([]byte, 64)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected user deadline to expire, got %v", err)
+	}
+}
+
+func TestDeadlineConn_ContextRead(t *testing.T) {
+	dc, client := newTestDeadlineConn(t, DeadlineConfig{Handshake: time.Second})
+	go func() {
+		_, _ = client.Write([]byte("X-Response: abc\n"))
+	}()
+
+	// A session round sets its deadline, then reads a line bounded by a
+	// context without a deadline of its own.
+	if err := dc.SetDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("Failed to set deadline: %v", err)
+	}
+	if _, err := proto.NewLineReader(dc, 0).ReadLine(context.Background()); err != nil {
+		t.Fatalf("Failed to read line: %v", err)
+	}
+	if _, err := dc.Read(make([]byte, 64)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected round deadline to expire, got %v", err)
+	}
+}
@@ -3,65 +3,230 @@ package server
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"wise-tcp/internal/auth"
+	"wise-tcp/internal/proto"
 	"wise-tcp/pkg/log"
 )
 
+// logComponent names the logger of connections, whose level can be set
+// apart from the rest.
+const logComponent = "server"
+
+// connIDs numbers the accepted connections for logging.
+var connIDs atomic.Uint64
+
 type connHandler struct {
-	throttle   *Throttle
-	auth       auth.RequestAuthorizer
-	reqHandler RequestHandler
+	throttle    *Throttle
+	auth        auth.RequestAuthorizer
+	prioritizer Prioritizer
+	reqHandler  RequestHandler
+	observer    LoadObserver
+	binary      bool
+	timeout     time.Duration
+	deadlines   DeadlineConfig
+	session     SessionConfig
+}
+
+// connState is the per-connection protocol state.
+type connState struct {
+	conn net.Conn
+	// rw is handed to the request handler; it wraps conn in data frames
+	// when the binary protocol is used.
+	rw    io.ReadWriter
+	codec *proto.Codec
+	// lines reads the text protocol; the authorizer and the session share
+	// it, so that nothing it buffered is lost between them.
+	lines *proto.LineReader
+	// overload is set when the connection was admitted past a saturated
+	// throttle and has to solve a harder challenge.
+	overload *auth.Overload
+}
+
+func (h *connHandler) newConnState(conn net.Conn) *connState {
+	c := &connState{conn: conn, rw: conn}
+	if h.binary {
+		c.codec = proto.NewCodec(conn)
+		c.rw = c.codec.Stream()
+	} else {
+		c.lines = proto.NewLineReader(conn, 0)
+	}
+	return c
 }
 
 func (h *connHandler) Handle(ctx context.Context, conn net.Conn) {
-	if err := h.throttle.Acquire(ctx, conn); err != nil {
+	connsAccepted.Inc()
+	if h.observer != nil {
+		h.observer.ObserveAccept()
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	id := connIDs.Add(1)
+	cctx = log.NewContext(cctx, log.Named(logComponent).With("conn", id))
+
+	// Set before throttling, as looking up the client address may read a
+	// PROXY protocol header.
+	dl, _ := cctx.Deadline()
+	hdl := h.deadlines.handshake(dl)
+	if err := conn.SetDeadline(hdl); err != nil {
+		log.FromContext(cctx).Errorf("Failed to set connection deadline: %v", err)
+		_ = conn.Close()
+		return
+	}
+	cctx = log.ContextWithFields(cctx, log.Fields{"addr": conn.RemoteAddr().String()})
+	// Session rounds run on ctx, under the same fields.
+	ctx = log.NewContext(ctx, log.FromContext(cctx))
+
+	var priority bool
+	conn, priority = h.prioritize(conn, hdl)
+
+	tctx := log.ContextWithFields(cctx, log.Fields{"phase": "throttle"})
+	release, overload, err := h.admit(tctx, conn, priority)
+	if err != nil {
+		_ = conn.Close()
 		if errors.Is(err, ErrConnRejected) || errors.Is(err, ErrConnDropped) {
-			log.Warnf("Connection throttled: %v", err)
+			connsThrottled.Inc(string(h.throttle.policy))
+			log.FromContext(tctx).Warnf("Connection throttled: %v", err)
 			return
 		}
-		log.Errorf("Acquire error: %v", err)
+		log.FromContext(tctx).Errorf("Acquire error: %v", err)
 		return
 	}
-	defer h.throttle.Release()
+	h.observeSaturation()
+	defer h.observeSaturation()
+	defer release()
+
+	if h.deadlines.enabled() {
+		// The handshake starts over once the client has a slot.
+		dc, err := newDeadlineConn(conn, h.deadlines, dl)
+		if err != nil {
+			log.FromContext(cctx).Errorf("Failed to set connection deadline: %v", err)
+			_ = conn.Close()
+			return
+		}
+		conn = dc
+	} else {
+		// Context-bound reads put the deadline set above back when done.
+		conn = &trackedConn{Conn: conn, readDL: hdl}
+	}
 	defer func(conn net.Conn) {
 		err := conn.Close()
 		if err != nil {
-			log.Errorf("Close connection: %v", err)
+			log.FromContext(cctx).Errorf("Close connection: %v", err)
 		}
 	}(conn)
 
-	dl, ok := ctx.Deadline()
-	if !ok {
-		log.Warnf("Context deadline not set")
-		return
-	}
-	if err := conn.SetDeadline(dl); err != nil {
-		log.Errorf("Failed to set connection deadline: %v", err)
-		return
-	}
+	c := h.newConnState(conn)
+	c.overload = overload
 
-	if h.auth != nil {
-		req := auth.Request{
-			ClientAddr: conn.RemoteAddr().String(),
-		}
-		if err := h.auth.AuthorizeRequest(ctx, req, conn); err != nil {
-			if errors.Is(err, auth.ErrUnauthorized) {
-				log.Warn("Unauthorized request")
-			} else {
-				log.Errorf("Authorize error: %v", err)
-			}
-			return
+	actx := log.ContextWithFields(cctx, log.Fields{"phase": "auth"})
+	if err = h.authorize(actx, c, false); err != nil {
+		connsRejected.Inc(rejectReason(err))
+		l := log.FromContext(actx)
+		if errors.Is(err, auth.ErrUnauthorized) {
+			l.Warn("Unauthorized request")
+		} else if errors.Is(err, ErrTooSlow) {
+			l.Warnf("Disconnected: %v", err)
+		} else {
+			l.Errorf("Authorize error: %v", err)
 		}
+		return
 	}
+	connsAuthorized.Inc()
 
-	if err := h.reqHandler.Handle(ctx, conn); err != nil {
+	hctx := log.ContextWithFields(cctx, log.Fields{"phase": "handle"})
+	if err = c.startWrite(); err != nil {
+		log.FromContext(hctx).Errorf("Failed to set connection deadline: %v", err)
+		return
+	}
+	if err = h.reqHandler.Handle(hctx, c.rw); err != nil {
+		handlerErrors.Inc()
 		var ne net.Error
 		if errors.As(err, &ne) && ne.Timeout() {
-			log.Warn("Connection timed out during processing")
+			log.FromContext(hctx).Warn("Connection timed out during processing")
 		} else {
-			log.Errorf("Handler failed to process request: %v", err)
+			log.FromContext(hctx).Errorf("Handler failed to process request: %v", err)
 		}
+		return
+	}
+
+	// An overload admission pays for one request only.
+	if h.session.Enabled && overload == nil {
+		cr := newCredit(h.session, time.Now())
+		cr.consume(time.Now())
+		h.serveSession(log.ContextWithFields(ctx, log.Fields{"phase": "session"}), c, cr)
+	}
+}
+
+// startWrite starts the write phase if the connection has phase
+// deadlines.
+func (c *connState) startWrite() error {
+	if dc, ok := c.conn.(*deadlineConn); ok {
+		return dc.startWrite()
+	}
+	return nil
+}
+
+// admit takes a throttle slot for the connection. A text protocol client
+// turned away by a saturated throttle may still be admitted on overload
+// terms, if the throttle offers them and there is a challenge to harden.
+func (h *connHandler) admit(ctx context.Context, conn net.Conn, priority bool) (func(), *auth.Overload, error) {
+	release, err := h.throttle.AcquirePriority(ctx, conn, priority)
+	if err == nil || !errors.Is(err, ErrOverloaded) {
+		return release, nil, err
+	}
+	if h.auth == nil || h.binary {
+		release()
+		rejectConn(conn)
+		return nil, nil, err
+	}
+	log.FromContext(ctx).Debug("Throttle saturated, admitting on overload terms")
+	return h.throttle.AcquireOverload(conn, release)
+}
+
+// prioritize looks for a solved challenge in the first line of a text
+// protocol client that would have to queue. The returned connection
+// replays whatever was read.
+func (h *connHandler) prioritize(conn net.Conn, deadline time.Time) (net.Conn, bool) {
+	if h.prioritizer == nil || h.binary {
+		return conn, false
+	}
+	window := h.throttle.priorityWindow()
+	if window <= 0 {
+		return conn, false
+	}
+
+	conn, line := peekFirstLine(conn, window, deadline)
+	if line == "" {
+		return conn, false
+	}
+	return conn, h.prioritizer.ValidResponse(conn.RemoteAddr().String(), line)
+}
+
+// authorize runs the authorizer, if any, on the connection. renewal is set
+// when an existing session runs out of credit.
+func (h *connHandler) authorize(ctx context.Context, c *connState, renewal bool) error {
+	if h.auth == nil {
+		return nil
+	}
+	req := auth.Request{
+		ClientAddr: c.conn.RemoteAddr().String(),
+		Codec:      c.codec,
+		Lines:      c.lines,
+		Renewal:    renewal,
+		Overload:   c.overload,
+	}
+	return h.auth.AuthorizeRequest(ctx, req, c.conn)
+}
+
+func (h *connHandler) observeSaturation() {
+	if h.observer != nil {
+		h.observer.ObserveSaturation(h.throttle.Saturation())
 	}
 }
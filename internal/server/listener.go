@@ -0,0 +1,187 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/proxyproto"
+	"wise-tcp/pkg/core/build"
+	"wise-tcp/pkg/handoff"
+	"wise-tcp/pkg/log"
+)
+
+// ListenerConfig describes one address the server accepts connections on.
+// Zero-valued overrides fall back to the server-wide settings.
+type ListenerConfig struct {
+	// Network is "tcp" (default), "tcp4", "tcp6" or "unix".
+	Network string `mapstructure:"network"`
+	// Address is host:port for TCP and a file path for Unix sockets.
+	Address string `mapstructure:"address"`
+	// Mode is the octal file mode of a Unix socket, e.g. "0660".
+	Mode    string        `mapstructure:"mode"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Throttle gives the listener its own connection slots instead of
+	// sharing the server throttle. Without a policy it takes the policy,
+	// queue and overload settings of the server throttle; per-source limits
+	// it leaves unset are taken from the server throttle as well.
+	Throttle *ThrottleConfig `mapstructure:"throttle"`
+	// Auth names the unit authorizing requests on this listener; "none"
+	// serves them without authorization.
+	Auth string `mapstructure:"auth"`
+}
+
+const (
+	networkUnix = "unix"
+	authNone    = "none"
+)
+
+func (c ListenerConfig) String() string {
+	return handoff.Name(c.Network, c.Address)
+}
+
+func (c *ListenerConfig) validate() error {
+	switch c.Network {
+	case "":
+		c.Network = "tcp"
+	case "tcp", "tcp4", "tcp6", networkUnix:
+	default:
+		return fmt.Errorf("listener %s: unknown network %q", c.Address, c.Network)
+	}
+	if c.Address == "" {
+		return fmt.Errorf("listener %s: address is required", c.Network)
+	}
+	if c.Mode != "" {
+		if c.Network != networkUnix {
+			return fmt.Errorf("listener %s: mode only applies to unix sockets", c)
+		}
+		if _, err := c.fileMode(); err != nil {
+			return fmt.Errorf("listener %s: invalid mode %q: %w", c, c.Mode, err)
+		}
+	}
+	return nil
+}
+
+func (c ListenerConfig) fileMode() (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return fs.FileMode(mode) & fs.ModePerm, nil
+}
+
+// listenerAuth resolves the authorizer named by a listener. An empty name
+// selects the server default.
+func listenerAuth(i *build.Injector, name string, def auth.RequestAuthorizer) (auth.RequestAuthorizer, error) {
+	switch name {
+	case "":
+		return def, nil
+	case authNone:
+		return nil, nil
+	default:
+		return build.Extract[auth.RequestAuthorizer](i, name)
+	}
+}
+
+// listener is a configured address together with the handler serving it.
+type listener struct {
+	cfg     ListenerConfig
+	handler *connHandler
+	// raw is the socket itself; ln wraps it in the PROXY protocol and TLS
+	// layers.
+	raw net.Listener
+	ln  net.Listener
+}
+
+func (l *listener) listen(certs *certReloader, proxies []netip.Prefix) error {
+	ln, err := l.open()
+	if err != nil {
+		return err
+	}
+	l.raw = ln
+	handoff.Register(l.cfg.String(), ln)
+
+	if l.cfg.Network == networkUnix {
+		log.Infof("TCP server listening on %s", l.cfg)
+		l.ln = ln
+		return nil
+	}
+	// The PROXY header precedes the TLS handshake.
+	if proxies != nil {
+		ln = proxyproto.NewListener(ln, proxies)
+	}
+	if certs != nil {
+		ln = tls.NewListener(ln, certs.Config())
+		log.Infof("TCP server listening on %s with TLS", l.cfg)
+	} else {
+		log.Infof("TCP server listening on %s", l.cfg)
+	}
+	l.ln = ln
+	return nil
+}
+
+// open takes over the socket from the previous process after a graceful
+// restart, or creates it.
+func (l *listener) open() (net.Listener, error) {
+	ln, ok, err := handoff.Listener(l.cfg.String())
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.Infof("Inherited listener %s from the previous process", l.cfg)
+		if ul, isUnix := ln.(*net.UnixListener); isUnix {
+			ul.SetUnlinkOnClose(true)
+		}
+		return ln, nil
+	}
+
+	if l.cfg.Network == networkUnix {
+		return l.listenUnix()
+	}
+	if ln, err = net.Listen(l.cfg.Network, l.cfg.Address); err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", l.cfg, err)
+	}
+	return ln, nil
+}
+
+// listenUnix creates a Unix socket. Such sockets are local, so neither TLS
+// nor the PROXY protocol applies.
+func (l *listener) listenUnix() (net.Listener, error) {
+	// A socket file left behind by a crashed process blocks the bind.
+	if fi, err := os.Lstat(l.cfg.Address); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		if err = os.Remove(l.cfg.Address); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", l.cfg.Address, err)
+		}
+	}
+
+	ln, err := net.Listen(networkUnix, l.cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", l.cfg, err)
+	}
+	if l.cfg.Mode != "" {
+		mode, _ := l.cfg.fileMode()
+		if err = os.Chmod(l.cfg.Address, mode); err != nil {
+			_ = ln.Close()
+			return nil, fmt.Errorf("failed to set mode of %s: %w", l.cfg.Address, err)
+		}
+	}
+	return ln, nil
+}
+
+func (l *listener) close() error {
+	if l.ln == nil {
+		return nil
+	}
+	handoff.Unregister(l.cfg.String())
+	if err := l.ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("failed to close listener %s: %w", l.cfg, err)
+	}
+	return nil
+}
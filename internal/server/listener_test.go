@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/pkg/core/build"
+)
+
+type quoteHandler struct{}
+
+func (quoteHandler) Handle(_ context.Context, rw io.ReadWriter) error {
+	_, err := rw.Write([]byte("quote\n"))
+	return err
+}
+
+type denyAuthorizer struct{}
+
+func (denyAuthorizer) AuthorizeRequest(_ context.Context, _ auth.Request, rw io.ReadWriter) error {
+	_, _ = rw.Write([]byte("X-Err: denied\n"))
+	return auth.ErrUnauthorized
+}
+
+func TestListenerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     ListenerConfig
+		wantErr bool
+	}{
+		{ListenerConfig{Address: ":9001"}, false},
+		{ListenerConfig{Network: "tcp6", Address: "[::1]:9001"}, false},
+		{ListenerConfig{Network: "unix", Address: "/tmp/wise.sock", Mode: "0660"}, false},
+		{ListenerConfig{Network: "udp", Address: ":9001"}, true},
+		{ListenerConfig{Network: "tcp"}, true},
+		{ListenerConfig{Address: ":9001", Mode: "0660"}, true},
+		{ListenerConfig{Network: "unix", Address: "/tmp/wise.sock", Mode: "rw"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v): expected error %v, got %v", tt.cfg, tt.wantErr, err)
+		}
+	}
+}
+
+func TestTCPServer_Listeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "wise.sock")
+	cfg := Config{
+		Timeout:  time.Second,
+		Throttle: ThrottleConfig{MaxConn: 2, Policy: string(BlockPolicy)},
+		Listeners: []ListenerConfig{
+			{Address: "127.0.0.1:0"},
+			{Network: "unix", Address: sock, Mode: "0600", Auth: "none"},
+		},
+	}
+
+	i := build.NewInjector()
+	i.Register(quoteHandler{}, "server.handler")
+	i.Register(denyAuthorizer{}, "server.auth")
+	item, err := Builder(cfg)(i)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	s := item.(*TCPServer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err = s.Start(ctx); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() { _ = s.Stop(ctx) }()
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %v", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("Expected socket mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	tests := []struct {
+		network string
+		addr    string
+		want    string
+	}{
+		{"tcp", s.listeners[0].ln.Addr().String(), "X-Err: denied\n"},
+		{"unix", sock, "quote\n"},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial(tt.network, tt.addr)
+		if err != nil {
+			t.Fatalf("Failed to dial %s: %v", tt.network, err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		_ = conn.Close()
+		if err != nil {
+			t.Fatalf("Failed to read from %s: %v", tt.network, err)
+		}
+		if line != tt.want {
+			t.Errorf("Expected %q on %s, got %q", tt.want, tt.network, line)
+		}
+	}
+}
+
+func TestBuilder_ListenerThrottle(t *testing.T) {
+	cfg := Config{
+		Throttle: ThrottleConfig{
+			MaxConn: 2,
+			Policy:  string(BlockPolicy),
+			PerIP:   intPtr(1),
+			Groups:  []ThrottleGroup{{Name: "office", CIDRs: []string{"192.0.2.0/24"}, Max: 1}},
+		},
+		Listeners: []ListenerConfig{
+			{Address: ":0"},
+			{Address: ":1", Throttle: &ThrottleConfig{MaxConn: 1}},
+		},
+	}
+
+	i := build.NewInjector()
+	i.Register(quoteHandler{}, "server.handler")
+	item, err := Builder(cfg)(i)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	s := item.(*TCPServer)
+
+	shared, own := s.listeners[0].handler.throttle, s.listeners[1].handler.throttle
+	if shared == own {
+		t.Fatal("Expected listener to get its own throttle")
+	}
+	if own.maxConn != 1 || own.policy != BlockPolicy {
+		t.Errorf("Expected max 1 with inherited policy, got %d %q", own.maxConn, own.policy)
+	}
+	if own.perIP != 1 || len(own.groups) != 1 {
+		t.Errorf("Expected inherited per-source limits, got per-IP %d and %d groups", own.perIP, len(own.groups))
+	}
+
+	cfg.Listeners[1].Throttle = &ThrottleConfig{MaxConn: 1, PerIP: intPtr(2), Groups: []ThrottleGroup{}}
+	item, err = Builder(cfg)(i)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	own = item.(*TCPServer).listeners[1].handler.throttle
+	if own.perIP != 2 || len(own.groups) != 0 {
+		t.Errorf("Expected overridden per-source limits, got per-IP %d and %d groups", own.perIP, len(own.groups))
+	}
+
+	// Zero turns the inherited per-IP limit off.
+	cfg.Listeners[1].Throttle = &ThrottleConfig{MaxConn: 1, PerIP: intPtr(0)}
+	item, err = Builder(cfg)(i)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	own = item.(*TCPServer).listeners[1].handler.throttle
+	if own.perIP != 0 {
+		t.Errorf("Expected per-IP limit disabled, got %d", own.perIP)
+	}
+
+	cfg.Listeners[1].Throttle = &ThrottleConfig{Policy: string(DropPolicy)}
+	if _, err = Builder(cfg)(i); err == nil {
+		t.Error("Expected error for throttle override without max")
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/pkg/metrics"
+)
+
+var (
+	connsAccepted = metrics.NewCounter("wise_connections_accepted_total",
+		"Connections accepted.")
+	connsThrottled = metrics.NewCounter("wise_connections_throttled_total",
+		"Connections turned away by the throttle, by throttle policy.", "policy")
+	connsAuthorized = metrics.NewCounter("wise_connections_authorized_total",
+		"Connections that passed authorization.")
+	connsRejected = metrics.NewCounter("wise_connections_rejected_total",
+		"Connections that failed authorization, by reason.", "reason")
+	handlerErrors = metrics.NewCounter("wise_handler_errors_total",
+		"Requests the request handler failed to serve.")
+)
+
+// rejectReason classifies an authorization failure for metrics.
+func rejectReason(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, auth.ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, auth.ErrProtoMismatch):
+		return "protocol"
+	case errors.Is(err, ErrTooSlow):
+		return "too_slow"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return "timeout"
+	default:
+		return "error"
+	}
+}
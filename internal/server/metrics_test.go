@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"wise-tcp/internal/auth"
+)
+
+func TestRejectReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{auth.ErrUnauthorized, "unauthorized"},
+		{fmt.Errorf("%w: line too long", auth.ErrProtoMismatch), "protocol"},
+		{fmt.Errorf("failed to read response: %w", ErrTooSlow), "too_slow"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("failed to read response: %w", os.ErrDeadlineExceeded), "timeout"},
+		{errors.New("verification error"), "error"},
+	}
+	for _, tt := range tests {
+		if got := rejectReason(tt.err); got != tt.want {
+			t.Errorf("rejectReason(%v): expected %q, got %q", tt.err, tt.want, got)
+		}
+	}
+}
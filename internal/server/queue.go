@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"wise-tcp/internal/proto"
+)
+
+// QueueConfig configures the queue throttle policy, under which
+// connections wait for a slot in a bounded queue instead of racing for it.
+type QueueConfig struct {
+	// Size caps the number of waiting connections; more are rejected.
+	Size int `mapstructure:"size"`
+	// Mode is "fifo" (default) or "fair", which serves the waiting sources
+	// in turn so that one address cannot fill the queue for everyone.
+	Mode string `mapstructure:"mode"`
+	// MaxWait is the longest a connection waits for a slot.
+	MaxWait time.Duration `mapstructure:"maxWait"`
+	// Target and Interval drive CoDel shedding: once the time spent in the
+	// queue stays above Target for Interval, waiting connections are shed,
+	// increasingly often, until the delay drops below Target again.
+	Target   time.Duration `mapstructure:"target"`
+	Interval time.Duration `mapstructure:"interval"`
+	// Peek is how long a connection that has to wait is given to send a
+	// pre-solved response, which moves it to the front of the queue.
+	Peek time.Duration `mapstructure:"peek"`
+}
+
+const (
+	QueueFIFO = "fifo"
+	QueueFair = "fair"
+)
+
+const (
+	defaultQueueSize     = 64
+	defaultQueueMaxWait  = 5 * time.Second
+	defaultQueueTarget   = 500 * time.Millisecond
+	defaultQueueInterval = 5 * time.Second
+	defaultQueuePeek     = 50 * time.Millisecond
+)
+
+var (
+	errQueueFull    = fmt.Errorf("%w: wait queue is full", ErrConnRejected)
+	errQueueTimeout = fmt.Errorf("%w: waited too long", ErrConnRejected)
+	errQueueShed    = fmt.Errorf("%w: queue delay above target", ErrConnRejected)
+)
+
+func (c *QueueConfig) applyDefaults() error {
+	switch c.Mode {
+	case "":
+		c.Mode = QueueFIFO
+	case QueueFIFO, QueueFair:
+	default:
+		return fmt.Errorf("unknown queue mode %q", c.Mode)
+	}
+	if c.Size <= 0 {
+		c.Size = defaultQueueSize
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = defaultQueueMaxWait
+	}
+	if c.Target <= 0 {
+		c.Target = defaultQueueTarget
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultQueueInterval
+	}
+	if c.Peek <= 0 {
+		c.Peek = defaultQueuePeek
+	}
+	return nil
+}
+
+type waiter struct {
+	subject  string
+	priority bool
+	enqueued time.Time
+	done     chan struct{}
+
+	// Guarded by waitQueue.mu; set before done is closed.
+	elem    *list.Element
+	granted bool
+	shed    bool
+}
+
+// subjectQueue holds the waiters of one source in fair mode; turn is its
+// place in the round robin.
+type subjectQueue struct {
+	waiters *list.List
+	turn    *list.Element
+}
+
+// waitQueue hands out a fixed number of slots. A released slot passes
+// straight to the next waiter: priority waiters first, then in FIFO order
+// or round robin over sources.
+type waitQueue struct {
+	cfg   QueueConfig
+	slots int64
+	now   func() time.Time
+
+	mu       sync.Mutex
+	used     int64
+	waiting  int
+	priority *list.List
+	fifo     *list.List
+	subjects map[string]*subjectQueue
+	turns    *list.List
+
+	// CoDel state.
+	firstAbove time.Time
+	dropping   bool
+	dropNext   time.Time
+	drops      int
+}
+
+func newWaitQueue(cfg QueueConfig, slots int) *waitQueue {
+	return &waitQueue{
+		cfg:      cfg,
+		slots:    int64(slots),
+		now:      time.Now,
+		priority: list.New(),
+		fifo:     list.New(),
+		subjects: make(map[string]*subjectQueue),
+		turns:    list.New(),
+	}
+}
+
+// acquire takes a slot, waiting in the queue if none is free.
+func (q *waitQueue) acquire(ctx context.Context, subject string, priority bool) error {
+	q.mu.Lock()
+	if q.used < q.slots && q.waiting == 0 {
+		q.used++
+		q.mu.Unlock()
+		return nil
+	}
+	if q.waiting >= q.cfg.Size {
+		q.mu.Unlock()
+		return errQueueFull
+	}
+	w := &waiter{
+		subject:  subject,
+		priority: priority,
+		enqueued: q.now(),
+		done:     make(chan struct{}),
+	}
+	q.push(w)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(q.cfg.MaxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.done:
+		if w.shed {
+			return errQueueShed
+		}
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = errQueueTimeout
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case w.granted:
+		// The slot arrived while giving up; pass it on.
+		q.releaseLocked()
+	case w.shed:
+		return errQueueShed
+	default:
+		q.remove(w)
+	}
+	return err
+}
+
+func (q *waitQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.releaseLocked()
+}
+
+func (q *waitQueue) releaseLocked() {
+	now := q.now()
+	for {
+		w := q.pop()
+		if w == nil {
+			q.used--
+			q.firstAbove = time.Time{}
+			q.dropping = false
+			return
+		}
+		// Priority waiters have done their work already and are never
+		// shed.
+		if !w.priority && q.shouldShed(now, now.Sub(w.enqueued)) {
+			w.shed = true
+			close(w.done)
+			continue
+		}
+		w.granted = true
+		close(w.done)
+		return
+	}
+}
+
+// busy reports whether a new connection would have to wait.
+func (q *waitQueue) busy() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.used >= q.slots || q.waiting > 0
+}
+
+// shouldShed implements the CoDel control law on the queue delay of the
+// waiter about to be served.
+func (q *waitQueue) shouldShed(now time.Time, sojourn time.Duration) bool {
+	if sojourn < q.cfg.Target {
+		q.firstAbove = time.Time{}
+		q.dropping = false
+		return false
+	}
+	if q.firstAbove.IsZero() {
+		q.firstAbove = now.Add(q.cfg.Interval)
+		return false
+	}
+	if now.Before(q.firstAbove) {
+		return false
+	}
+	if !q.dropping {
+		q.dropping = true
+		q.drops = 1
+		q.dropNext = now.Add(q.dropSpacing())
+		return true
+	}
+	if now.Before(q.dropNext) {
+		return false
+	}
+	q.drops++
+	q.dropNext = q.dropNext.Add(q.dropSpacing())
+	return true
+}
+
+// dropSpacing shrinks with the number of drops, so shedding speeds up as
+// long as the delay stays high.
+func (q *waitQueue) dropSpacing() time.Duration {
+	return time.Duration(float64(q.cfg.Interval) / math.Sqrt(float64(q.drops)))
+}
+
+func (q *waitQueue) push(w *waiter) {
+	q.waiting++
+	switch {
+	case w.priority:
+		w.elem = q.priority.PushBack(w)
+	case q.cfg.Mode == QueueFair:
+		sq, ok := q.subjects[w.subject]
+		if !ok {
+			sq = &subjectQueue{waiters: list.New()}
+			sq.turn = q.turns.PushBack(w.subject)
+			q.subjects[w.subject] = sq
+		}
+		w.elem = sq.waiters.PushBack(w)
+	default:
+		w.elem = q.fifo.PushBack(w)
+	}
+}
+
+func (q *waitQueue) pop() *waiter {
+	var w *waiter
+	switch {
+	case q.priority.Len() > 0:
+		w = q.priority.Front().Value.(*waiter)
+	case q.cfg.Mode == QueueFair && q.turns.Len() > 0:
+		sq := q.subjects[q.turns.Front().Value.(string)]
+		w = sq.waiters.Front().Value.(*waiter)
+		// The source goes to the back of the round robin.
+		q.turns.MoveToBack(sq.turn)
+	case q.fifo.Len() > 0:
+		w = q.fifo.Front().Value.(*waiter)
+	default:
+		return nil
+	}
+	q.remove(w)
+	return w
+}
+
+func (q *waitQueue) remove(w *waiter) {
+	q.waiting--
+	switch {
+	case w.priority:
+		q.priority.Remove(w.elem)
+	case q.cfg.Mode == QueueFair:
+		sq := q.subjects[w.subject]
+		sq.waiters.Remove(w.elem)
+		if sq.waiters.Len() == 0 {
+			q.turns.Remove(sq.turn)
+			delete(q.subjects, w.subject)
+		}
+	default:
+		q.fifo.Remove(w.elem)
+	}
+}
+
+// peekedConn replays the bytes read while peeking at a connection.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// peekFirstLine waits up to window for the client to send a line and
+// returns it without consuming it: the returned connection reads it again.
+// deadline is the read deadline to restore afterwards.
+func peekFirstLine(conn net.Conn, window time.Duration, deadline time.Time) (net.Conn, string) {
+	// A timed out read would break the TLS handshake for good.
+	if _, ok := conn.(*tls.Conn); ok {
+		return conn, ""
+	}
+
+	pc := &peekedConn{Conn: conn, r: bufio.NewReaderSize(conn, proto.DefaultMaxLine)}
+	if err := conn.SetReadDeadline(time.Now().Add(window)); err != nil {
+		return conn, ""
+	}
+	_, _ = pc.r.Peek(1)
+	_ = conn.SetReadDeadline(deadline)
+
+	buf, _ := pc.r.Peek(pc.r.Buffered())
+	line, _, ok := bytes.Cut(buf, []byte("\n"))
+	if !ok {
+		return pc, ""
+	}
+	return pc, string(line)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestQueue(cfg QueueConfig, slots int) *waitQueue {
+	if cfg.MaxWait == 0 {
+		cfg.MaxWait = time.Second
+	}
+	_ = cfg.applyDefaults()
+	return newWaitQueue(cfg, slots)
+}
+
+// enqueue starts a waiter and returns once it is in the queue. The
+// waiter's name is sent on order when it gets a slot.
+func enqueue(t *testing.T, q *waitQueue, name, subject string, priority bool, order chan<- string) {
+	t.Helper()
+	q.mu.Lock()
+	n := q.waiting
+	q.mu.Unlock()
+
+	go func() {
+		if err := q.acquire(context.Background(), subject, priority); err != nil {
+			order <- name + ": " + err.Error()
+			return
+		}
+		order <- name
+	}()
+
+	for i := 0; i < 100; i++ {
+		q.mu.Lock()
+		queued := q.waiting > n
+		q.mu.Unlock()
+		if queued {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Waiter %s was not queued", name)
+}
+
+func expectOrder(t *testing.T, q *waitQueue, order <-chan string, want ...string) {
+	t.Helper()
+	for _, name := range want {
+		q.release()
+		select {
+		case got := <-order:
+			if got != name {
+				t.Fatalf("Expected %s to get the slot, got %s", name, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s to get the slot", name)
+		}
+	}
+}
+
+func TestWaitQueue_FIFO(t *testing.T) {
+	q := newTestQueue(QueueConfig{}, 1)
+	if err := q.acquire(context.Background(), "a", false); err != nil {
+		t.Fatalf("Failed to acquire free slot: %v", err)
+	}
+
+	order := make(chan string, 4)
+	enqueue(t, q, "first", "a", false, order)
+	enqueue(t, q, "second", "b", false, order)
+	enqueue(t, q, "solved", "a", true, order)
+
+	expectOrder(t, q, order, "solved", "first", "second")
+
+	q.release()
+	if q.used != 0 || q.busy() {
+		t.Errorf("Expected queue to be idle, got %d slots in use", q.used)
+	}
+}
+
+func TestWaitQueue_Fair(t *testing.T) {
+	q := newTestQueue(QueueConfig{Mode: QueueFair}, 1)
+	if err := q.acquire(context.Background(), "a", false); err != nil {
+		t.Fatalf("Failed to acquire free slot: %v", err)
+	}
+
+	order := make(chan string, 4)
+	enqueue(t, q, "a1", "a", false, order)
+	enqueue(t, q, "a2", "a", false, order)
+	enqueue(t, q, "a3", "a", false, order)
+	enqueue(t, q, "b1", "b", false, order)
+
+	expectOrder(t, q, order, "a1", "b1", "a2", "a3")
+	if len(q.subjects) != 0 || q.turns.Len() != 0 {
+		t.Errorf("Expected empty round robin, got %d subjects", len(q.subjects))
+	}
+}
+
+func TestWaitQueue_Bounds(t *testing.T) {
+	q := newTestQueue(QueueConfig{Size: 1, MaxWait: 20 * time.Millisecond}, 1)
+	if err := q.acquire(context.Background(), "a", false); err != nil {
+		t.Fatalf("Failed to acquire free slot: %v", err)
+	}
+
+	order := make(chan string, 1)
+	enqueue(t, q, "waiting", "a", false, order)
+
+	if err := q.acquire(context.Background(), "b", false); !errors.Is(err, errQueueFull) {
+		t.Errorf("Expected full queue, got %v", err)
+	}
+
+	got := <-order
+	if got != "waiting: "+errQueueTimeout.Error() {
+		t.Errorf("Expected waiter to time out, got %q", got)
+	}
+	if q.waiting != 0 {
+		t.Errorf("Expected timed out waiter to leave the queue, got %d waiting", q.waiting)
+	}
+	if !errors.Is(errQueueTimeout, ErrConnRejected) {
+		t.Error("Expected queue errors to count as rejections")
+	}
+}
+
+func TestWaitQueue_CoDel(t *testing.T) {
+	q := newTestQueue(QueueConfig{Target: 100 * time.Millisecond, Interval: time.Second}, 1)
+	start := time.Now()
+	slow := 200 * time.Millisecond
+
+	steps := []struct {
+		at      time.Duration
+		sojourn time.Duration
+		want    bool
+	}{
+		// Delay above target starts the interval.
+		{0, slow, false},
+		{500 * time.Millisecond, slow, false},
+		// Still above target after a full interval: shed.
+		{time.Second, slow, true},
+		{1100 * time.Millisecond, slow, false},
+		// The next drop is one interval later, then interval/sqrt(2).
+		{2 * time.Second, slow, true},
+		{2*time.Second + 700*time.Millisecond, slow, false},
+		{2*time.Second + 710*time.Millisecond, slow, true},
+		// Delay back under target stops shedding.
+		{3 * time.Second, 10 * time.Millisecond, false},
+		{4 * time.Second, slow, false},
+	}
+	for _, s := range steps {
+		if got := q.shouldShed(start.Add(s.at), s.sojourn); got != s.want {
+			t.Errorf("shouldShed at %v with delay %v: expected %v, got %v", s.at, s.sojourn, s.want, got)
+		}
+	}
+}
+
+func TestWaitQueue_Shed(t *testing.T) {
+	q := newTestQueue(QueueConfig{Target: time.Millisecond, Interval: time.Millisecond}, 1)
+	if err := q.acquire(context.Background(), "a", false); err != nil {
+		t.Fatalf("Failed to acquire free slot: %v", err)
+	}
+
+	order := make(chan string, 3)
+	enqueue(t, q, "stale", "a", false, order)
+	enqueue(t, q, "solved", "b", true, order)
+	enqueue(t, q, "next", "c", false, order)
+
+	// Age the queue past the interval.
+	now := time.Now()
+	q.mu.Lock()
+	q.firstAbove = now.Add(-time.Second)
+	q.now = func() time.Time { return now }
+	q.mu.Unlock()
+
+	// The priority waiter is served, then the stale one is shed and the
+	// slot goes on to the next.
+	expectOrder(t, q, order, "solved")
+	q.release()
+	got := map[string]bool{<-order: true, <-order: true}
+	if !got["stale: "+errQueueShed.Error()] || !got["next"] {
+		t.Errorf("Expected stale waiter to be shed and the next one served, got %v", got)
+	}
+}
+
+func TestPeekFirstLine(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() { _, _ = client.Write([]byte("X-Response: 1:20\nrest")) }()
+
+	conn, line := peekFirstLine(server, time.Second, time.Time{})
+	if line != "X-Response: 1:20" {
+		t.Errorf("Expected response line, got %q", line)
+	}
+	go func() { _ = client.Close() }()
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(data) != "X-Response: 1:20\nrest" {
+		t.Errorf("Expected peeked data to be replayed, got %q", data)
+	}
+}
+
+func TestPeekFirstLine_Silent(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn, line := peekFirstLine(server, 10*time.Millisecond, time.Time{})
+	if line != "" {
+		t.Errorf("Expected no line from a silent client, got %q", line)
+	}
+
+	go func() { _, _ = client.Write([]byte("late\n")) }()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Expected connection to stay usable after peeking, got %v", err)
+	}
+}
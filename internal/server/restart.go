@@ -0,0 +1,15 @@
+package server
+
+import "time"
+
+type RestartConfig struct {
+	// Enabled re-executes the server on SIGUSR2, handing the listening
+	// sockets to the new process instead of closing them. It is only
+	// supported on Unix systems.
+	Enabled bool `mapstructure:"enabled" env:"GRACEFUL_RESTART"`
+	// ReadyTimeout bounds how long the new process may take to start
+	// serving before it is killed and the old one carries on.
+	ReadyTimeout time.Duration `mapstructure:"readyTimeout"`
+}
+
+const defaultReadyTimeout = 10 * time.Second
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package server
+
+import (
+	"context"
+
+	"wise-tcp/pkg/log"
+)
+
+// watchRestart only reports that graceful restarts are not available on
+// this platform.
+func (s *TCPServer) watchRestart(context.Context) {
+	log.Warn("Graceful restart is not supported on this platform, ignoring")
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"wise-tcp/pkg/handoff"
+	"wise-tcp/pkg/log"
+)
+
+// watchRestart hands the listeners over to a new process on every SIGUSR2
+// until one handoff succeeds.
+func (s *TCPServer) watchRestart(ctx context.Context) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGUSR2)
+	defer signal.Stop(sigc)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigc:
+			if err := s.restart(); err != nil {
+				log.Errorf("Graceful restart failed, still serving: %v", err)
+				continue
+			}
+			return
+		}
+	}
+}
+
+func (s *TCPServer) restart() error {
+	timeout := s.cfg.Restart.ReadyTimeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	// Every registered socket is handed over, including those of other
+	// units such as the admin server.
+	files, err := handoff.Registered()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Handing listeners over to a new process...")
+	pid, err := handoff.Restart(files, timeout)
+	if err != nil {
+		return err
+	}
+	log.Infof("New process %d is serving, draining connections", pid)
+
+	// The socket file now belongs to the new process.
+	for _, l := range s.listeners {
+		if ul, ok := l.raw.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	if err = s.closeListeners(); err != nil {
+		log.Errorf("Failed to close listeners after handoff: %v", err)
+	}
+
+	// Shut down through the regular path, which waits for in-flight
+	// connections.
+	if err = syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		log.Errorf("Failed to signal shutdown after handoff: %v", err)
+	}
+	return nil
+}
@@ -6,20 +6,52 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
+	"strings"
 	"sync"
 	"time"
 
 	"wise-tcp/internal/auth"
+	"wise-tcp/internal/proxyproto"
 	"wise-tcp/pkg/core/build"
 	"wise-tcp/pkg/log"
 )
 
 type Config struct {
-	Port     int            `mapstructure:"port" env:"PORT"`
-	Timeout  time.Duration  `mapstructure:"timeout"`
-	Throttle ThrottleConfig `mapstructure:"throttle" env:"MAX_CONN"`
+	// Port is served on all interfaces unless Listeners is set.
+	Port    int           `mapstructure:"port" env:"PORT"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Deadlines bound the phases of a connection within Timeout.
+	Deadlines DeadlineConfig `mapstructure:"deadlines"`
+	Throttle  ThrottleConfig `mapstructure:"throttle" env:"MAX_CONN"`
+	// Protocol is the wire protocol: "text" (X- lines, default) or
+	// "binary" (length-prefixed frames).
+	Protocol string `mapstructure:"protocol" env:"PROTOCOL"`
+	// Session keeps authorized connections open for further requests. A
+	// session holds its throttle slot until the connection is closed.
+	Session SessionConfig `mapstructure:"session"`
+	TLS     TLSConfig     `mapstructure:"tls"`
+	// ProxyProtocol takes client addresses from PROXY protocol headers sent
+	// by trusted load balancers.
+	ProxyProtocol ProxyProtocolConfig `mapstructure:"proxyProtocol"`
+	// Listeners replaces the single listener on Port, e.g. to add a Unix
+	// socket for internal clients next to the public port.
+	Listeners []ListenerConfig `mapstructure:"listeners"`
+	Restart   RestartConfig    `mapstructure:"restart"`
 }
 
+type ProxyProtocolConfig struct {
+	Enabled bool `mapstructure:"enabled" env:"PROXY_PROTOCOL"`
+	// Trusted lists the CIDRs of the proxies; headers from other sources
+	// are not parsed.
+	Trusted []string `mapstructure:"trusted"`
+}
+
+const (
+	ProtocolText   = "text"
+	ProtocolBinary = "binary"
+)
+
 func (c Config) Name() string {
 	return "tcp-server"
 }
@@ -28,12 +60,26 @@ type RequestHandler interface {
 	Handle(ctx context.Context, rw io.ReadWriter) error
 }
 
+// LoadObserver is notified about accepted connections and throttle
+// saturation, e.g. to adapt the PoW difficulty to the server load.
+type LoadObserver interface {
+	ObserveAccept()
+	ObserveSaturation(saturation float64)
+}
+
+// Prioritizer recognizes a solved challenge in the first line a client
+// sends, so that the client can skip the throttle wait queue.
+type Prioritizer interface {
+	ValidResponse(subject, line string) bool
+}
+
 type TCPServer struct {
-	addr     string
-	listener net.Listener
-	cfg      Config
-	handler  *connHandler
-	wg       sync.WaitGroup
+	listeners []*listener
+	running   bool
+	cfg       Config
+	tls       *certReloader
+	proxies   []netip.Prefix
+	wg        sync.WaitGroup
 }
 
 type Option func(*TCPServer)
@@ -45,45 +91,148 @@ func Builder(cfg Config) build.Builder {
 			return nil, err
 		}
 
-		a, err := build.Extract[auth.RequestAuthorizer](i, "server.auth")
+		a, ok, err := build.ExtractOptional[auth.RequestAuthorizer](i, "server.auth")
 		if err != nil {
-			log.Error(err)
+			return nil, err
+		}
+		if !ok {
+			log.Warn("No authorizer registered, serving requests without authorization")
 		}
 
-		return &TCPServer{
-			cfg:  cfg,
-			addr: fmt.Sprintf(":%d", cfg.Port),
-			handler: &connHandler{
-				throttle:   NewThrottle(cfg.Throttle),
-				auth:       a,
+		o, _, err := build.ExtractOptional[LoadObserver](i, "pow.difficulty")
+		if err != nil {
+			return nil, err
+		}
+
+		switch cfg.Protocol {
+		case "":
+			cfg.Protocol = ProtocolText
+		case ProtocolText, ProtocolBinary:
+		default:
+			return nil, fmt.Errorf("unknown protocol %q", cfg.Protocol)
+		}
+
+		if err := cfg.Session.validate(); err != nil {
+			return nil, err
+		}
+
+		var certs *certReloader
+		if cfg.TLS.Enabled {
+			if certs, err = newCertReloader(cfg.TLS); err != nil {
+				return nil, err
+			}
+		}
+
+		var proxies []netip.Prefix
+		if cfg.ProxyProtocol.Enabled {
+			if proxies, err = proxyproto.ParseTrusted(cfg.ProxyProtocol.Trusted); err != nil {
+				return nil, err
+			}
+			if len(proxies) == 0 {
+				return nil, fmt.Errorf("proxy protocol needs at least one trusted proxy")
+			}
+		}
+
+		specs := cfg.Listeners
+		if len(specs) == 0 {
+			specs = []ListenerConfig{{Address: fmt.Sprintf(":%d", cfg.Port)}}
+		}
+
+		throttle, err := NewThrottle(cfg.Throttle)
+		if err != nil {
+			return nil, err
+		}
+		listeners := make([]*listener, 0, len(specs))
+		for _, spec := range specs {
+			if err := spec.validate(); err != nil {
+				return nil, err
+			}
+
+			la, err := listenerAuth(i, spec.Auth, a)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", spec, err)
+			}
+			lh := &connHandler{
+				throttle:   throttle,
+				auth:       la,
 				reqHandler: h,
-			},
+				observer:   o,
+				binary:     cfg.Protocol == ProtocolBinary,
+				timeout:    cfg.Timeout,
+				deadlines:  cfg.Deadlines,
+				session:    cfg.Session,
+			}
+			if spec.Throttle != nil {
+				tc := *spec.Throttle
+				if tc.MaxConn <= 0 {
+					return nil, fmt.Errorf("listener %s: throttle needs a positive max", spec)
+				}
+				if tc.Policy == "" {
+					tc.Policy, tc.Timeout, tc.Queue = cfg.Throttle.Policy, cfg.Throttle.Timeout, cfg.Throttle.Queue
+					tc.Overload = cfg.Throttle.Overload
+				}
+				if tc.PerIP == nil {
+					tc.PerIP, tc.IPv6Prefix = cfg.Throttle.PerIP, cfg.Throttle.IPv6Prefix
+				}
+				if tc.Groups == nil {
+					tc.Groups = cfg.Throttle.Groups
+				}
+				if lh.throttle, err = NewThrottle(tc); err != nil {
+					return nil, fmt.Errorf("listener %s: %w", spec, err)
+				}
+				// Only the shared throttle reflects the server load.
+				lh.observer = nil
+			}
+			if p, ok := la.(Prioritizer); ok {
+				lh.prioritizer = p
+			}
+			if spec.Timeout > 0 {
+				lh.timeout = spec.Timeout
+			}
+			listeners = append(listeners, &listener{cfg: spec, handler: lh})
+		}
+
+		return &TCPServer{
+			tls:       certs,
+			proxies:   proxies,
+			cfg:       cfg,
+			listeners: listeners,
 		}, nil
 	}
 }
 
 func (s *TCPServer) Start(ctx context.Context) error {
-	if s.listener != nil {
+	if s.running {
 		return fmt.Errorf("server is already running")
 	}
 
 	log.Debugf("Initializing server with config: %#v", s.cfg)
 
-	var err error
-	s.listener, err = net.Listen("tcp", s.addr)
-	if err != nil {
-		return fmt.Errorf("failed to start server: %w", err)
+	for _, l := range s.listeners {
+		if err := l.listen(s.tls, s.proxies); err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+	}
+	s.running = true
+
+	if s.tls != nil {
+		go s.tls.watch(ctx)
+	}
+	for _, l := range s.listeners {
+		go s.acceptLoop(ctx, l)
 	}
-	log.Infof("TCP server listening on %s", s.addr)
 
-	go s.acceptLoop(ctx)
+	if s.cfg.Restart.Enabled {
+		go s.watchRestart(ctx)
+	}
 
 	return nil
 }
 
-func (s *TCPServer) acceptLoop(ctx context.Context) {
+func (s *TCPServer) acceptLoop(ctx context.Context, l *listener) {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := l.ln.Accept()
 		if err != nil {
 			select {
 			case <-ctx.Done():
@@ -94,7 +243,7 @@ func (s *TCPServer) acceptLoop(ctx context.Context) {
 					// listener closed, ignore
 					return
 				}
-				log.Error("Failed to accept connection: %v", err)
+				log.Errorf("Failed to accept connection: %v", err)
 			}
 			continue
 		}
@@ -102,9 +251,7 @@ func (s *TCPServer) acceptLoop(ctx context.Context) {
 		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			cctx, cancel := context.WithDeadline(ctx, time.Now().Add(s.cfg.Timeout))
-			defer cancel()
-			s.handler.Handle(cctx, conn)
+			l.handler.Handle(ctx, conn)
 		}()
 	}
 }
@@ -112,10 +259,8 @@ func (s *TCPServer) acceptLoop(ctx context.Context) {
 func (s *TCPServer) Stop(ctx context.Context) error {
 	log.Info("Shutting down TCP server...")
 
-	if s.listener != nil {
-		if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
-			return fmt.Errorf("failed to close listener: %w", err)
-		}
+	if err := s.closeListeners(); err != nil {
+		return err
 	}
 
 	done := make(chan struct{})
@@ -134,6 +279,18 @@ func (s *TCPServer) Stop(ctx context.Context) error {
 	return nil
 }
 
+func (s *TCPServer) closeListeners() error {
+	var errs []error
+	for _, l := range s.listeners {
+		errs = append(errs, l.close())
+	}
+	return errors.Join(errs...)
+}
+
 func (s *TCPServer) String() string {
-	return fmt.Sprintf("TCPServer on %s", s.addr)
+	addrs := make([]string, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.cfg.String()
+	}
+	return fmt.Sprintf("TCPServer on %s", strings.Join(addrs, ", "))
 }
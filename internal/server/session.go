@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/proto"
+	"wise-tcp/pkg/log"
+)
+
+// SessionConfig enables pay-once sessions: a solved challenge buys a credit
+// of Requests requests or TTL time on the same connection, whichever runs
+// out first. A zero limit does not apply, but at least one must be set.
+type SessionConfig struct {
+	Enabled  bool          `mapstructure:"enabled" env:"SESSION"`
+	Requests int           `mapstructure:"requests"`
+	TTL      time.Duration `mapstructure:"ttl"`
+}
+
+// requestPrefix starts a request line of the text protocol.
+const requestPrefix = "X-Request:"
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+func (c SessionConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Requests < 0 || c.TTL < 0 {
+		return fmt.Errorf("session limits must not be negative")
+	}
+	if c.Requests == 0 && c.TTL == 0 {
+		return fmt.Errorf("session needs a requests or ttl limit")
+	}
+	return nil
+}
+
+// credit is what is left of the budget bought with the last solved
+// challenge.
+type credit struct {
+	cfg       SessionConfig
+	remaining int
+	expires   time.Time
+}
+
+func newCredit(cfg SessionConfig, now time.Time) *credit {
+	c := &credit{cfg: cfg}
+	c.renew(now)
+	return c
+}
+
+func (c *credit) renew(now time.Time) {
+	c.remaining = c.cfg.Requests
+	c.expires = time.Time{}
+	if c.cfg.TTL > 0 {
+		c.expires = now.Add(c.cfg.TTL)
+	}
+}
+
+// consume takes one request from the credit and reports whether there was
+// any left.
+func (c *credit) consume(now time.Time) bool {
+	if !c.expires.IsZero() && !now.Before(c.expires) {
+		return false
+	}
+	if c.cfg.Requests > 0 {
+		if c.remaining <= 0 {
+			return false
+		}
+		c.remaining--
+	}
+	return true
+}
+
+// serveSession serves further requests on an authorized connection until
+// the client disconnects or stays idle for a whole round. The request
+// served with the handshake has already been charged to cr. When cr runs
+// out, the client is challenged again before its request is served.
+func (h *connHandler) serveSession(ctx context.Context, c *connState, cr *credit) {
+	for {
+		err := h.round(ctx, c, func(rctx context.Context) error {
+			if err := c.readCommand(rctx); err != nil {
+				return err
+			}
+			if !cr.consume(time.Now()) {
+				log.FromContext(ctx).Debug("Session credit exhausted, challenging again")
+				if err := h.authorize(rctx, c, true); err != nil {
+					return err
+				}
+				cr.renew(time.Now())
+				cr.consume(time.Now())
+			}
+			if err := c.startWrite(); err != nil {
+				return err
+			}
+			return h.reqHandler.Handle(rctx, c.rw)
+		})
+		if err != nil {
+			logSessionEnd(ctx, err)
+			return
+		}
+	}
+}
+
+// round runs fn under its own deadline of one server timeout.
+func (h *connHandler) round(ctx context.Context, c *connState, fn func(ctx context.Context) error) error {
+	rctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	dl, _ := rctx.Deadline()
+	if err := c.conn.SetDeadline(dl); err != nil {
+		return fmt.Errorf("failed to set connection deadline: %w", err)
+	}
+
+	return fn(rctx)
+}
+
+func logSessionEnd(ctx context.Context, err error) {
+	l := log.FromContext(ctx)
+	var ne net.Error
+	switch {
+	case errors.Is(err, io.EOF):
+		l.Debug("Session closed by client")
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		l.Debug("Session idle, closing connection")
+	case errors.Is(err, auth.ErrUnauthorized):
+		l.Warn("Unauthorized session renewal")
+	default:
+		l.Errorf("Session ended: %v", err)
+	}
+}
+
+// readCommand reads the next request: an "X-Request:" line or a request
+// frame.
+func (c *connState) readCommand(ctx context.Context) error {
+	if c.codec != nil {
+		_, err := c.codec.Expect(proto.MsgRequest)
+		return err
+	}
+
+	line, err := c.lines.ReadLine(ctx)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, requestPrefix) {
+		if _, werr := c.conn.Write([]byte("X-Err: " + ErrUnknownCommand.Error() + "\n")); werr != nil {
+			log.FromContext(ctx).Error(werr)
+		}
+		return fmt.Errorf("%w: %q", ErrUnknownCommand, line)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/pkg/core/build"
+)
+
+// lineAuthorizer accepts a client that sends "X-Response: ok".
+type lineAuthorizer struct{}
+
+func (lineAuthorizer) AuthorizeRequest(ctx context.Context, request auth.Request, _ io.ReadWriter) error {
+	line, err := request.Lines.ReadLine(ctx)
+	if err != nil {
+		return err
+	}
+	if line != "X-Response: ok" {
+		return auth.ErrUnauthorized
+	}
+	return nil
+}
+
+func TestCredit_Requests(t *testing.T) {
+	now := time.Now()
+	c := newCredit(SessionConfig{Enabled: true, Requests: 2}, now)
+
+	for i := 0; i < 2; i++ {
+		if !c.consume(now) {
+			t.Fatalf("Expected request %d to be covered", i+1)
+		}
+	}
+	if c.consume(now) {
+		t.Error("Expected credit to be exhausted")
+	}
+
+	c.renew(now)
+	if !c.consume(now.Add(time.Hour)) {
+		t.Error("Expected renewed credit without ttl to cover request")
+	}
+}
+
+func TestCredit_TTL(t *testing.T) {
+	now := time.Now()
+	c := newCredit(SessionConfig{Enabled: true, TTL: time.Minute}, now)
+
+	for i := 0; i < 100; i++ {
+		if !c.consume(now.Add(59 * time.Second)) {
+			t.Fatal("Expected unlimited requests within ttl")
+		}
+	}
+	if c.consume(now.Add(time.Minute)) {
+		t.Error("Expected credit to expire")
+	}
+
+	c.renew(now.Add(time.Minute))
+	if !c.consume(now.Add(time.Minute)) {
+		t.Error("Expected renewed credit to cover request")
+	}
+}
+
+func TestCredit_RequestsAndTTL(t *testing.T) {
+	now := time.Now()
+	c := newCredit(SessionConfig{Enabled: true, Requests: 5, TTL: time.Minute}, now)
+
+	if c.consume(now.Add(2 * time.Minute)) {
+		t.Error("Expected expired credit to be exhausted with requests left")
+	}
+}
+
+func TestSessionConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     SessionConfig
+		wantErr bool
+	}{
+		{SessionConfig{}, false},
+		{SessionConfig{Enabled: true, Requests: 3}, false},
+		{SessionConfig{Enabled: true, TTL: time.Second}, false},
+		{SessionConfig{Enabled: true}, true},
+		{SessionConfig{Enabled: true, Requests: -1, TTL: time.Second}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v): expected error %v, got %v", tt.cfg, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSession_SharedLineReader(t *testing.T) {
+	cfg := Config{
+		Timeout:   time.Second,
+		Throttle:  ThrottleConfig{MaxConn: 1, Policy: string(BlockPolicy)},
+		Session:   SessionConfig{Enabled: true, Requests: 2},
+		Listeners: []ListenerConfig{{Address: "127.0.0.1:0"}},
+	}
+
+	i := build.NewInjector()
+	i.Register(quoteHandler{}, "server.handler")
+	i.Register(lineAuthorizer{}, "server.auth")
+	item, err := Builder(cfg)(i)
+	if err != nil {
+		t.Fatalf("Failed to build server: %v", err)
+	}
+	s := item.(*TCPServer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err = s.Start(ctx); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() { _ = s.Stop(ctx) }()
+
+	conn, err := net.Dial("tcp", s.listeners[0].ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	// The next request arrives together with the response, so the
+	// authorizer reads past its line.
+	if _, err = conn.Write([]byte("X-Response: ok\nX-Request: quote\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	for n := 1; n <= 2; n++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read quote %d: %v", n, err)
+		}
+		if line != "quote\n" {
+			t.Errorf("Expected quote %d, got %q", n, line)
+		}
+	}
+}
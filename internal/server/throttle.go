@@ -3,16 +3,51 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/semaphore"
+
+	"wise-tcp/internal/auth"
 )
 
 type ThrottleConfig struct {
 	MaxConn int           `mapstructure:"max" env:"MAX_CONN"`
 	Policy  string        `mapstructure:"policy"`
 	Timeout time.Duration `mapstructure:"timeout"`
+	// PerIP caps the connections from a single IPv4 address or IPv6
+	// network of IPv6Prefix bits (default 64). Zero disables the limit;
+	// a listener throttle that leaves it unset inherits both settings.
+	PerIP      *int `mapstructure:"perIP" env:"MAX_CONN_PER_IP"`
+	IPv6Prefix int  `mapstructure:"ipv6Prefix"`
+	// Groups cap the connections from each set of networks as a whole.
+	Groups []ThrottleGroup `mapstructure:"groups"`
+	Queue  QueueConfig     `mapstructure:"queue"`
+	// Overload lets text protocol clients turned away by the reject or
+	// queue policy solve a harder challenge to get in anyway.
+	Overload OverloadConfig `mapstructure:"overload"`
+}
+
+type OverloadConfig struct {
+	Enabled bool `mapstructure:"enabled" env:"OVERLOAD"`
+	// ExtraBits is added to the difficulty of the overload challenge.
+	ExtraBits int `mapstructure:"extraBits"`
+	// RetryAfter is the hint sent to clients that would rather come back
+	// later.
+	RetryAfter time.Duration `mapstructure:"retryAfter"`
+	// Max caps the connections admitted this way; it defaults to the
+	// global limit.
+	Max int `mapstructure:"max"`
+}
+
+type ThrottleGroup struct {
+	Name  string   `mapstructure:"name"`
+	CIDRs []string `mapstructure:"cidrs"`
+	Max   int      `mapstructure:"max"`
 }
 
 type ThrottlePolicy string
@@ -21,48 +56,325 @@ const (
 	BlockPolicy  ThrottlePolicy = "block"
 	RejectPolicy ThrottlePolicy = "reject"
 	DropPolicy   ThrottlePolicy = "drop"
+	// QueuePolicy makes connections wait in a bounded queue; see
+	// QueueConfig.
+	QueuePolicy ThrottlePolicy = "queue"
+)
+
+const defaultIPv6Prefix = 64
+
+const (
+	defaultOverloadExtraBits  = 4
+	defaultOverloadRetryAfter = 5 * time.Second
 )
 
 var (
 	ErrConnRejected = errors.New("connection rejected: too many connections")
 	ErrConnDropped  = errors.New("connection dropped: too many connections")
+	// ErrOverloaded is returned instead of ErrConnRejected when overload
+	// admission is enabled; the connection is left open.
+	ErrOverloaded = errors.New("server overloaded")
 )
 
 type Throttle struct {
 	maxConn int64
+	active  atomic.Int64
 	sem     *semaphore.Weighted
 	policy  ThrottlePolicy
 	timeout time.Duration
+
+	perIP      int64
+	ipv6Prefix int
+	groups     []throttleGroup
+	queue      *waitQueue
+	overload   *OverloadConfig
+	overloaded *semaphore.Weighted
+
+	mu      sync.Mutex
+	sources map[string]*sourceSlots
+}
+
+type throttleGroup struct {
+	name     string
+	prefixes []netip.Prefix
+	max      int64
+}
+
+// sourceSlots limits the connections of one source. refs counts holders
+// and waiters, so the entry can be dropped once nobody uses it.
+type sourceSlots struct {
+	sem  *semaphore.Weighted
+	refs int
+}
+
+func NewThrottle(cfg ThrottleConfig) (*Throttle, error) {
+	t := &Throttle{
+		sem:        semaphore.NewWeighted(int64(cfg.MaxConn)),
+		maxConn:    int64(cfg.MaxConn),
+		policy:     ThrottlePolicy(cfg.Policy),
+		timeout:    cfg.Timeout,
+		ipv6Prefix: cfg.IPv6Prefix,
+		sources:    make(map[string]*sourceSlots),
+	}
+	if cfg.PerIP != nil {
+		t.perIP = int64(*cfg.PerIP)
+	}
+	if t.ipv6Prefix <= 0 {
+		t.ipv6Prefix = defaultIPv6Prefix
+	}
+	if t.policy == QueuePolicy {
+		qc := cfg.Queue
+		if err := qc.applyDefaults(); err != nil {
+			return nil, err
+		}
+		t.queue = newWaitQueue(qc, cfg.MaxConn)
+	}
+	if cfg.Overload.Enabled {
+		oc := cfg.Overload
+		if oc.ExtraBits <= 0 {
+			oc.ExtraBits = defaultOverloadExtraBits
+		}
+		if oc.RetryAfter <= 0 {
+			oc.RetryAfter = defaultOverloadRetryAfter
+		}
+		if oc.Max <= 0 {
+			oc.Max = cfg.MaxConn
+		}
+		t.overload = &oc
+		t.overloaded = semaphore.NewWeighted(int64(oc.Max))
+	}
+
+	for _, g := range cfg.Groups {
+		if g.Name == "" || g.Max <= 0 {
+			return nil, fmt.Errorf("throttle group %q needs a name and a positive max", g.Name)
+		}
+		tg := throttleGroup{name: g.Name, max: int64(g.Max)}
+		for _, cidr := range g.CIDRs {
+			p, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("throttle group %s: %w", g.Name, err)
+			}
+			tg.prefixes = append(tg.prefixes, p.Masked())
+		}
+		t.groups = append(t.groups, tg)
+	}
+	return t, nil
+}
+
+// Acquire takes a slot for every limit the connection falls under: its
+// source address, the groups containing it and finally the global limit.
+// The returned release gives them all back; it is safe to call more than
+// once.
+func (t *Throttle) Acquire(ctx context.Context, conn net.Conn) (release func(), err error) {
+	return t.AcquirePriority(ctx, conn, false)
+}
+
+// AcquirePriority is Acquire for a connection that may skip the wait queue
+// of the queue policy, because it arrived with a solved challenge.
+//
+// With ErrOverloaded it still returns a release, which holds the source
+// slots of the connection for AcquireOverload, so that admission on
+// overload terms stays within the per-source limits.
+func (t *Throttle) AcquirePriority(ctx context.Context, conn net.Conn, priority bool) (release func(), err error) {
+	var held []string
+	var sourcesOnce sync.Once
+	releaseSources := func() {
+		sourcesOnce.Do(func() {
+			for _, key := range held {
+				t.releaseSource(key)
+			}
+		})
+	}
+
+	ip, hasIP := sourceIP(conn.RemoteAddr())
+	if hasIP {
+		for _, src := range t.sourceLimits(ip) {
+			if err = t.acquireSource(ctx, conn, src.key, src.max); err != nil {
+				releaseSources()
+				if errors.Is(err, ErrConnRejected) {
+					rejectConn(conn)
+				}
+				return nil, fmt.Errorf("%w (%s)", err, src.key)
+			}
+			held = append(held, src.key)
+		}
+	}
+
+	if t.queue != nil {
+		subject := ""
+		if hasIP {
+			subject = t.ipKey(ip)
+		}
+		err = t.queue.acquire(ctx, subject, priority)
+	} else {
+		err = t.acquire(ctx, conn, t.sem)
+	}
+	if err != nil {
+		if errors.Is(err, ErrConnRejected) && t.overload != nil {
+			return releaseSources, fmt.Errorf("%w: %w", ErrOverloaded, err)
+		}
+		releaseSources()
+		if errors.Is(err, ErrConnRejected) {
+			rejectConn(conn)
+		}
+		return nil, err
+	}
+	t.active.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.active.Add(-1)
+			if t.queue != nil {
+				t.queue.release()
+			} else {
+				t.sem.Release(1)
+			}
+			releaseSources()
+		})
+	}, nil
+}
+
+// AcquireOverload admits a connection that got ErrOverloaded into the
+// pool of clients paying with a harder challenge, and returns the terms.
+// sources is the release returned along with ErrOverloaded; the returned
+// release gives back the source slots it holds as well. If the pool is
+// full the connection is rejected and sources released.
+func (t *Throttle) AcquireOverload(conn net.Conn, sources func()) (func(), *auth.Overload, error) {
+	if sources == nil {
+		sources = func() {}
+	}
+	if t.overloaded == nil || !t.overloaded.TryAcquire(1) {
+		sources()
+		rejectConn(conn)
+		return nil, nil, ErrConnRejected
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			t.overloaded.Release(1)
+			sources()
+		})
+	}
+	return release, &auth.Overload{ExtraBits: t.overload.ExtraBits, RetryAfter: t.overload.RetryAfter}, nil
+}
+
+// priorityWindow returns how long a new connection may be watched for a
+// pre-solved response, or 0 if it would not have to queue anyway.
+func (t *Throttle) priorityWindow() time.Duration {
+	if t.queue == nil || !t.queue.busy() {
+		return 0
+	}
+	return t.queue.cfg.Peek
 }
 
-func NewThrottle(cfg ThrottleConfig) *Throttle {
-	return &Throttle{
-		sem:     semaphore.NewWeighted(int64(cfg.MaxConn)),
-		maxConn: int64(cfg.MaxConn),
-		policy:  ThrottlePolicy(cfg.Policy),
-		timeout: cfg.Timeout,
+func sourceIP(addr net.Addr) (netip.Addr, bool) {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		// Unix sockets have no source to tell clients apart.
+		return netip.Addr{}, false
+	}
+	return tcp.AddrPort().Addr().Unmap(), true
+}
+
+type sourceLimit struct {
+	key string
+	max int64
+}
+
+func (t *Throttle) sourceLimits(ip netip.Addr) []sourceLimit {
+	var limits []sourceLimit
+	if t.perIP > 0 {
+		limits = append(limits, sourceLimit{key: "ip:" + t.ipKey(ip), max: t.perIP})
+	}
+	for _, g := range t.groups {
+		for _, p := range g.prefixes {
+			if p.Contains(ip) {
+				limits = append(limits, sourceLimit{key: "group:" + g.name, max: g.max})
+				break
+			}
+		}
+	}
+	return limits
+}
+
+// ipKey groups IPv6 clients by network, since a single host usually holds
+// a whole /64.
+func (t *Throttle) ipKey(ip netip.Addr) string {
+	if ip.Is4() {
+		return ip.String()
+	}
+	p, err := ip.WithZone("").Prefix(t.ipv6Prefix)
+	if err != nil {
+		return ip.String()
 	}
+	return p.String()
 }
 
-func (t *Throttle) Acquire(ctx context.Context, conn net.Conn) error {
+func (t *Throttle) acquireSource(ctx context.Context, conn net.Conn, key string, max int64) error {
+	t.mu.Lock()
+	s, ok := t.sources[key]
+	if !ok {
+		s = &sourceSlots{sem: semaphore.NewWeighted(max)}
+		t.sources[key] = s
+	}
+	s.refs++
+	t.mu.Unlock()
+
+	if err := t.acquire(ctx, conn, s.sem); err != nil {
+		t.unref(key, s)
+		return err
+	}
+	return nil
+}
+
+func (t *Throttle) releaseSource(key string) {
+	t.mu.Lock()
+	s := t.sources[key]
+	t.mu.Unlock()
+
+	s.sem.Release(1)
+	t.unref(key, s)
+}
+
+func (t *Throttle) unref(key string, s *sourceSlots) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s.refs--
+	if s.refs == 0 {
+		delete(t.sources, key)
+	}
+}
+
+func (t *Throttle) acquire(ctx context.Context, conn net.Conn, sem *semaphore.Weighted) error {
 	switch t.policy {
 	case BlockPolicy:
-		return t.sem.Acquire(ctx, 1)
+		return sem.Acquire(ctx, 1)
 
 	case RejectPolicy:
 		rejectCtx, cancel := context.WithTimeout(ctx, t.timeout)
 		defer cancel()
 
-		err := t.sem.Acquire(rejectCtx, 1)
+		err := sem.Acquire(rejectCtx, 1)
 		if err != nil {
-			_, _ = conn.Write([]byte("Service Unavailable\n"))
-			_ = conn.Close()
+			return ErrConnRejected
+		}
+		return nil
+
+	case QueuePolicy:
+		// Source limits wait like the queue, but without ordering.
+		waitCtx, cancel := context.WithTimeout(ctx, t.queue.cfg.MaxWait)
+		defer cancel()
+
+		if err := sem.Acquire(waitCtx, 1); err != nil {
 			return ErrConnRejected
 		}
 		return nil
 
 	case DropPolicy:
-		if t.sem.TryAcquire(1) {
+		if sem.TryAcquire(1) {
 			return nil
 		}
 
@@ -74,6 +386,15 @@ func (t *Throttle) Acquire(ctx context.Context, conn net.Conn) error {
 	}
 }
 
-func (t *Throttle) Release() {
-	t.sem.Release(1)
+func rejectConn(conn net.Conn) {
+	_, _ = conn.Write([]byte("Service Unavailable\n"))
+	_ = conn.Close()
+}
+
+// Saturation returns the share of connection slots in use, from 0 to 1.
+func (t *Throttle) Saturation() float64 {
+	if t.maxConn <= 0 {
+		return 0
+	}
+	return float64(t.active.Load()) / float64(t.maxConn)
 }
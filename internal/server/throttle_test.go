@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// addrConn is a pipe that reports a chosen client address.
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func newAddrConn(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	go func() { _, _ = client.Read(make([]byte, 64)) }()
+
+	if addr == "" {
+		return addrConn{Conn: server, addr: &net.UnixAddr{Name: "@", Net: "unix"}}
+	}
+	tcp, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addrConn{Conn: server, addr: tcp}
+}
+
+func newTestThrottle(t *testing.T, cfg ThrottleConfig) *Throttle {
+	t.Helper()
+	th, err := NewThrottle(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create throttle: %v", err)
+	}
+	return th
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestThrottle_PerIP(t *testing.T) {
+	th := newTestThrottle(t, ThrottleConfig{MaxConn: 10, Policy: string(DropPolicy), PerIP: intPtr(1)})
+	ctx := context.Background()
+
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"192.0.2.1:1000", false},
+		{"192.0.2.1:1001", true},
+		{"192.0.2.2:1000", false},
+		{"[2001:db8::1]:1000", false},
+		// Same /64 as the previous address.
+		{"[2001:db8::2]:1000", true},
+		{"[2001:db8:0:1::1]:1000", false},
+		// Unix sockets carry no source address.
+		{"", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		_, err := th.Acquire(ctx, newAddrConn(t, tt.addr))
+		if tt.wantErr != (err != nil) {
+			t.Errorf("Acquire(%q): expected error %v, got %v", tt.addr, tt.wantErr, err)
+		}
+		if err != nil && !errors.Is(err, ErrConnDropped) {
+			t.Errorf("Acquire(%q): expected ErrConnDropped, got %v", tt.addr, err)
+		}
+	}
+}
+
+func TestThrottle_Groups(t *testing.T) {
+	th := newTestThrottle(t, ThrottleConfig{
+		MaxConn: 10,
+		Policy:  string(RejectPolicy),
+		Timeout: 10 * time.Millisecond,
+		Groups: []ThrottleGroup{
+			{Name: "office", CIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"}, Max: 2},
+		},
+	})
+	ctx := context.Background()
+
+	for _, addr := range []string{"10.0.0.1:1000", "192.168.1.1:1000"} {
+		if _, err := th.Acquire(ctx, newAddrConn(t, addr)); err != nil {
+			t.Fatalf("Failed to acquire for %s: %v", addr, err)
+		}
+	}
+	if _, err := th.Acquire(ctx, newAddrConn(t, "10.1.1.1:1000")); !errors.Is(err, ErrConnRejected) {
+		t.Errorf("Expected group to be full, got %v", err)
+	}
+	if _, err := th.Acquire(ctx, newAddrConn(t, "192.0.2.1:1000")); err != nil {
+		t.Errorf("Expected address outside the group to pass, got %v", err)
+	}
+}
+
+func TestThrottle_Release(t *testing.T) {
+	th := newTestThrottle(t, ThrottleConfig{MaxConn: 1, Policy: string(BlockPolicy), PerIP: intPtr(1)})
+
+	release, err := th.Acquire(context.Background(), newAddrConn(t, "192.0.2.1:1000"))
+	if err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	if th.Saturation() != 1 {
+		t.Errorf("Expected saturation 1, got %v", th.Saturation())
+	}
+
+	// A second client of the same address waits for the first one.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = th.Acquire(ctx, newAddrConn(t, "192.0.2.1:1001")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected blocked acquire to time out, got %v", err)
+	}
+
+	release()
+	release()
+	if th.Saturation() != 0 {
+		t.Errorf("Expected saturation 0, got %v", th.Saturation())
+	}
+	if len(th.sources) != 0 {
+		t.Errorf("Expected source slots to be freed, got %d", len(th.sources))
+	}
+
+	release, err = th.Acquire(context.Background(), newAddrConn(t, "192.0.2.1:1002"))
+	if err != nil {
+		t.Fatalf("Failed to acquire after release: %v", err)
+	}
+	release()
+}
+
+func TestNewThrottle_InvalidGroup(t *testing.T) {
+	groups := [][]ThrottleGroup{
+		{{Name: "bad", CIDRs: []string{"10.0.0.0/33"}, Max: 1}},
+		{{Name: "", CIDRs: []string{"10.0.0.0/8"}, Max: 1}},
+		{{Name: "zero", CIDRs: []string{"10.0.0.0/8"}}},
+	}
+	for _, g := range groups {
+		if _, err := NewThrottle(ThrottleConfig{MaxConn: 1, Groups: g}); err == nil {
+			t.Errorf("Expected error for group %+v", g)
+		}
+	}
+}
+
+func TestThrottle_Overload(t *testing.T) {
+	th := newTestThrottle(t, ThrottleConfig{
+		MaxConn:  1,
+		Policy:   string(RejectPolicy),
+		Timeout:  10 * time.Millisecond,
+		Overload: OverloadConfig{Enabled: true, Max: 1},
+	})
+	ctx := context.Background()
+
+	if _, err := th.Acquire(ctx, newAddrConn(t, "192.0.2.1:1000")); err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	conn := newAddrConn(t, "192.0.2.2:1000")
+	sources, err := th.Acquire(ctx, conn)
+	if !errors.Is(err, ErrOverloaded) || !errors.Is(err, ErrConnRejected) {
+		t.Fatalf("Expected ErrOverloaded, got %v", err)
+	}
+
+	release, ov, err := th.AcquireOverload(conn, sources)
+	if err != nil {
+		t.Fatalf("Failed to acquire on overload terms: %v", err)
+	}
+	if ov.ExtraBits != defaultOverloadExtraBits || ov.RetryAfter != defaultOverloadRetryAfter {
+		t.Errorf("Expected default overload terms, got %+v", ov)
+	}
+	if _, _, err = th.AcquireOverload(newAddrConn(t, "192.0.2.3:1000"), nil); !errors.Is(err, ErrConnRejected) {
+		t.Errorf("Expected full overload pool to reject, got %v", err)
+	}
+
+	release()
+	release()
+	if _, _, err = th.AcquireOverload(newAddrConn(t, "192.0.2.3:1001"), nil); err != nil {
+		t.Errorf("Failed to acquire after release: %v", err)
+	}
+}
+
+func TestThrottle_OverloadPerIP(t *testing.T) {
+	th := newTestThrottle(t, ThrottleConfig{
+		MaxConn:  1,
+		Policy:   string(RejectPolicy),
+		Timeout:  10 * time.Millisecond,
+		PerIP:    intPtr(1),
+		Overload: OverloadConfig{Enabled: true, Max: 4},
+	})
+	ctx := context.Background()
+
+	if _, err := th.Acquire(ctx, newAddrConn(t, "192.0.2.1:1000")); err != nil {
+		t.Fatalf("Failed to acquire: %v", err)
+	}
+	conn := newAddrConn(t, "192.0.2.2:1000")
+	sources, err := th.Acquire(ctx, conn)
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Expected ErrOverloaded, got %v", err)
+	}
+	release, _, err := th.AcquireOverload(conn, sources)
+	if err != nil {
+		t.Fatalf("Failed to acquire on overload terms: %v", err)
+	}
+
+	// The overload slot keeps the per-IP slot, so a second connection from
+	// the same address is turned away before it gets to overload terms.
+	_, err = th.Acquire(ctx, newAddrConn(t, "192.0.2.2:1001"))
+	if !errors.Is(err, ErrConnRejected) || errors.Is(err, ErrOverloaded) {
+		t.Errorf("Expected per-IP rejection, got %v", err)
+	}
+
+	release()
+	conn = newAddrConn(t, "192.0.2.2:1002")
+	if sources, err = th.Acquire(ctx, conn); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Expected ErrOverloaded after release, got %v", err)
+	}
+	if _, _, err = th.AcquireOverload(conn, sources); err != nil {
+		t.Errorf("Failed to acquire on overload terms after release: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"wise-tcp/pkg/log"
+	"wise-tcp/pkg/tlsutil"
+)
+
+type TLSConfig struct {
+	Enabled  bool   `mapstructure:"enabled" env:"TLS"`
+	CertFile string `mapstructure:"cert" env:"TLS_CERT"`
+	KeyFile  string `mapstructure:"key" env:"TLS_KEY"`
+	// ClientCAFile enables mutual TLS: clients must present a certificate
+	// signed by one of these CAs.
+	ClientCAFile string `mapstructure:"clientCA"`
+	// MinVersion is "1.2" (default) or "1.3".
+	MinVersion string `mapstructure:"minVersion"`
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval time.Duration `mapstructure:"reloadInterval"`
+}
+
+const defaultReloadInterval = 30 * time.Second
+
+// certReloader serves the certificate and client CAs from disk and reloads
+// them when the files change, so they can be rotated without a restart.
+type certReloader struct {
+	cfg        TLSConfig
+	minVersion uint16
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls needs a cert and key file")
+	}
+	minVersion, err := tlsutil.ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultReloadInterval
+	}
+
+	r := &certReloader{
+		cfg:        cfg,
+		minVersion: minVersion,
+	}
+	if err = r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time, 3)
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", f, err)
+		}
+		modTimes[f] = fi.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	var clientCA *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		if clientCA, err = tlsutil.LoadCertPool(r.cfg.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCA = clientCA
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any of the files was modified since the last
+// load.
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, f := range r.files() {
+		fi, err := os.Stat(f)
+		if err != nil {
+			// The file may be in the middle of being replaced.
+			continue
+		}
+		if !fi.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) reloadIfChanged() {
+	if !r.changed() {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.Errorf("Failed to reload TLS certificates, keeping the current ones: %v", err)
+		return
+	}
+	log.Info("TLS certificates reloaded")
+}
+
+func (r *certReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reloadIfChanged()
+		}
+	}
+}
+
+// Config returns the server TLS config; every handshake uses the
+// certificates loaded last.
+func (r *certReloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			cfg := &tls.Config{
+				MinVersion:   r.minVersion,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCA != nil {
+				cfg.ClientCAs = r.clientCA
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate signed by the CA and its key to dir.
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serialOf(t *testing.T, r *certReloader) int64 {
+	t.Helper()
+	cfg, err := r.Config().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, dir, "server", 10, x509.ExtKeyUsageServerAuth)
+
+	r, err := newCertReloader(TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+	if got := serialOf(t, r); got != 10 {
+		t.Fatalf("Expected serial 10, got %d", got)
+	}
+
+	r.reloadIfChanged()
+	if got := serialOf(t, r); got != 10 {
+		t.Errorf("Expected unchanged serial 10, got %d", got)
+	}
+
+	// Modification times may have a coarse resolution, so move them on
+	// explicitly.
+	ca.issue(t, dir, "server", 11, x509.ExtKeyUsageServerAuth)
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err = os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.reloadIfChanged()
+	if got := serialOf(t, r); got != 11 {
+		t.Errorf("Expected reloaded serial 11, got %d", got)
+	}
+
+	// A broken file keeps the current certificate.
+	writeFile(t, certFile, []byte("garbage"))
+	if err = os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	r.reloadIfChanged()
+	if got := serialOf(t, r); got != 11 {
+		t.Errorf("Expected serial 11 after failed reload, got %d", got)
+	}
+}
+
+func TestCertReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, dir, "server", 10, x509.ExtKeyUsageServerAuth)
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.pem)
+
+	r, err := newCertReloader(TLSConfig{
+		Enabled:      true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+		MinVersion:   "1.3",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", r.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_, _ = conn.Write([]byte("ok"))
+			_ = conn.Close()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dial := func(certs ...tls.Certificate) error {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "server",
+			Certificates: certs,
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// With TLS 1.3 a rejected client certificate shows up on read.
+		_, err = conn.Read(make([]byte, 2))
+		return err
+	}
+
+	if err = dial(); err == nil {
+		t.Error("Expected handshake without client certificate to fail")
+	}
+
+	clientCert, clientKey := ca.issue(t, dir, "client", 20, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dial(cert); err != nil {
+		t.Errorf("Expected handshake with client certificate to succeed, got %v", err)
+	}
+}
+
+func TestNewCertReloader_Invalid(t *testing.T) {
+	if _, err := newCertReloader(TLSConfig{Enabled: true}); err == nil {
+		t.Error("Expected error without cert and key")
+	}
+	if _, err := newCertReloader(TLSConfig{Enabled: true, CertFile: "x", KeyFile: "y", MinVersion: "1.0"}); err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+}
@@ -0,0 +1,178 @@
+package token
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/internal/proto"
+	"wise-tcp/pkg/core"
+	"wise-tcp/pkg/core/build"
+	"wise-tcp/pkg/log"
+)
+
+// Config enables bearer tokens: a client that solved a challenge receives
+// a token it can present instead of a new proof of work on up to Uses
+// connections within TTL. Secrets are base64 encoded; ActiveKey selects the
+// key used for minting.
+type Config struct {
+	Enabled bool          `mapstructure:"enabled" env:"TOKEN_ENABLED"`
+	TTL     time.Duration `mapstructure:"ttl"`
+	Uses    int           `mapstructure:"uses"`
+	// Binding is the subject binding policy: exact, ip (default), prefix64
+	// or none.
+	Binding string `mapstructure:"binding"`
+	// Backend counts token uses in "memory" or "redis"; redis uses pow.redis.
+	Backend   string `mapstructure:"backend"`
+	ActiveKey string `mapstructure:"activeKey"`
+	Keys      []Key  `mapstructure:"keys"`
+}
+
+type Key struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// tokenPrefix starts the text protocol line carrying a token.
+const tokenPrefix = "X-Token:"
+
+// Authorizer authorizes requests by bearer token.
+type Authorizer struct {
+	issuer *Issuer
+	cache  hashcash.ChallengeCache
+}
+
+func Builder(cfg Config, redisAddr string) build.Builder {
+	return func(_ *build.Injector) (any, error) {
+		keys := make(map[string][]byte, len(cfg.Keys))
+		for _, k := range cfg.Keys {
+			secret, err := base64.StdEncoding.DecodeString(k.Secret)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret for token key %q: %w", k.ID, err)
+			}
+			keys[k.ID] = secret
+		}
+
+		var cache hashcash.ChallengeCache
+		switch cfg.Backend {
+		case "", "memory":
+			cache = hashcash.NewMemoryCache(time.Minute)
+		case "redis":
+			cache = hashcash.NewRedisCache(redisAddr)
+		default:
+			return nil, fmt.Errorf("unknown token backend %q", cfg.Backend)
+		}
+
+		opts := []Option{WithTTL(cfg.TTL), WithUses(cfg.Uses)}
+		if cfg.Binding != "" {
+			binding, err := hashcash.ParseBinding(cfg.Binding)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithBinding(binding))
+		}
+
+		issuer, err := NewIssuer(cfg.ActiveKey, keys, cache, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return NewAuthorizer(issuer, cache), nil
+	}
+}
+
+func NewAuthorizer(issuer *Issuer, cache hashcash.ChallengeCache) *Authorizer {
+	return &Authorizer{
+		issuer: issuer,
+		cache:  cache,
+	}
+}
+
+func (a *Authorizer) Start(ctx context.Context) error {
+	return a.cache.Start(ctx)
+}
+
+func (a *Authorizer) Stop(ctx context.Context) error {
+	return a.cache.Stop(ctx)
+}
+
+func (a *Authorizer) CheckHealth(ctx context.Context) error {
+	return core.CheckHealth(ctx, a.cache)
+}
+
+// Mint returns a new token for subject.
+func (a *Authorizer) Mint(subject string) (string, error) {
+	return a.issuer.Mint(subject)
+}
+
+// AuthorizeRequest verifies request.Token. When the request carries no
+// token, it is read from rw as an "X-Token:" line, or as a token frame on
+// binary connections.
+func (a *Authorizer) AuthorizeRequest(ctx context.Context, request auth.Request, rw io.ReadWriter) error {
+	token := request.Token
+	if token == "" {
+		var err error
+		if token, err = a.readToken(ctx, request, rw); err != nil {
+			return err
+		}
+	}
+
+	err := a.issuer.Verify(token, request.ClientAddr)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, hashcash.ErrSubjectMismatch):
+		// A token presented by another client is most likely stolen; it
+		// is not told why it was rejected.
+		a.reject(request, rw, ErrInvalidToken.Error())
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenExpired), errors.Is(err, ErrTokenExhausted):
+		a.reject(request, rw, err.Error())
+	default:
+		return fmt.Errorf("token verification error: %w", err)
+	}
+
+	return fmt.Errorf("%w: %w", auth.ErrUnauthorized, err)
+}
+
+func (a *Authorizer) readToken(ctx context.Context, request auth.Request, rw io.ReadWriter) (string, error) {
+	if request.Codec != nil {
+		token, err := request.Codec.Expect(proto.MsgToken)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", auth.ErrProtoMismatch, err)
+		}
+		return string(token), nil
+	}
+
+	lines := request.Lines
+	if lines == nil {
+		lines = proto.NewLineReader(rw, 0)
+	}
+	line, err := lines.ReadLine(ctx)
+	if err != nil {
+		if errors.Is(err, proto.ErrLineTooLong) {
+			return "", fmt.Errorf("%w: %v", auth.ErrProtoMismatch, err)
+		}
+		return "", err
+	}
+	if !strings.HasPrefix(line, tokenPrefix) {
+		return "", auth.ErrProtoMismatch
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, tokenPrefix)), nil
+}
+
+func (a *Authorizer) reject(request auth.Request, w io.Writer, reason string) {
+	var err error
+	if request.Codec != nil {
+		err = request.Codec.Write(proto.MsgError, []byte(reason))
+	} else {
+		_, err = w.Write([]byte("X-Err: " + reason + "\n"))
+	}
+	if err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,181 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"wise-tcp/internal/pow/providers/hashcash"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrTokenExpired   = errors.New("token expired")
+	ErrTokenExhausted = errors.New("token used up")
+)
+
+const (
+	defaultTTL  = 10 * time.Minute
+	defaultUses = 10
+
+	partSep    = "."
+	fieldSep   = "|"
+	minKeySize = 16
+)
+
+// Issuer mints and verifies bearer tokens of the form
+// `<kid>.<payload>.<mac>`. The payload holds the subject, expiry, usage
+// budget and a random id, and the mac is an HMAC-SHA256 over kid and
+// payload. Uses are counted per id in the challenge cache.
+type Issuer struct {
+	active  string
+	keys    map[string][]byte
+	cache   hashcash.ChallengeCache
+	ttl     time.Duration
+	uses    int
+	binding hashcash.Binding
+	now     func() time.Time
+}
+
+type Option func(*Issuer)
+
+func WithTTL(ttl time.Duration) Option {
+	return func(i *Issuer) {
+		if ttl > 0 {
+			i.ttl = ttl
+		}
+	}
+}
+
+// WithUses sets how many connections a token authorizes.
+func WithUses(n int) Option {
+	return func(i *Issuer) {
+		if n > 0 {
+			i.uses = n
+		}
+	}
+}
+
+// WithBinding sets the policy matching the token subject against the
+// presenting client; the default is BindIP.
+func WithBinding(b hashcash.Binding) Option {
+	return func(i *Issuer) {
+		i.binding = b
+	}
+}
+
+func NewIssuer(active string, keys map[string][]byte, cache hashcash.ChallengeCache, opts ...Option) (*Issuer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one token key is required")
+	}
+	for kid, key := range keys {
+		if kid == "" || strings.Contains(kid, partSep) {
+			return nil, fmt.Errorf("invalid key id %q", kid)
+		}
+		if len(key) < minKeySize {
+			return nil, fmt.Errorf("token key %q must be at least %d bytes", kid, minKeySize)
+		}
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q not found", active)
+	}
+
+	i := &Issuer{
+		active:  active,
+		keys:    make(map[string][]byte, len(keys)),
+		cache:   cache,
+		ttl:     defaultTTL,
+		uses:    defaultUses,
+		binding: hashcash.BindIP,
+		now:     time.Now,
+	}
+	for kid, key := range keys {
+		i.keys[kid] = append([]byte(nil), key...)
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
+}
+
+// Mint returns a new token for subject.
+func (i *Issuer) Mint(subject string) (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(strings.Join([]string{
+		subject,
+		strconv.FormatInt(i.now().Add(i.ttl).Unix(), 10),
+		strconv.Itoa(i.uses),
+		base64.RawURLEncoding.EncodeToString(id),
+	}, fieldSep)))
+
+	return strings.Join([]string{i.active, payload, i.mac(i.keys[i.active], i.active, payload)}, partSep), nil
+}
+
+// Verify checks that token is valid for the client at addr and spends one
+// of its uses.
+func (i *Issuer) Verify(token, addr string) error {
+	parts := strings.Split(strings.TrimSpace(token), partSep)
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	kid, payload, mac := parts[0], parts[1], parts[2]
+
+	key, ok := i.keys[kid]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	if !hmac.Equal([]byte(mac), []byte(i.mac(key, kid, payload))) {
+		return ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	fields := strings.Split(string(raw), fieldSep)
+	if len(fields) != 4 {
+		return fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	subject, id := fields[0], fields[3]
+	exp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad expiry", ErrInvalidToken)
+	}
+	uses, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return fmt.Errorf("%w: bad usage budget", ErrInvalidToken)
+	}
+
+	ttl := time.Unix(exp, 0).Sub(i.now())
+	if ttl <= 0 {
+		return ErrTokenExpired
+	}
+	if !i.binding.Match(subject, addr) {
+		return hashcash.ErrSubjectMismatch
+	}
+
+	used, err := i.cache.Incr("token:"+id, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to count token use: %w", err)
+	}
+	if used > int64(uses) {
+		return ErrTokenExhausted
+	}
+	return nil
+}
+
+func (i *Issuer) mac(key []byte, kid, payload string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(kid + partSep + payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"wise-tcp/internal/auth"
+	"wise-tcp/internal/pow/providers/hashcash"
+	"wise-tcp/internal/proto"
+)
+
+const (
+	clientAddr = "192.0.2.1:5000"
+	otherAddr  = "198.51.100.7:5000"
+)
+
+func newTestIssuer(t *testing.T, active string, opts ...Option) *Issuer {
+	t.Helper()
+	cache := hashcash.NewMemoryCache(time.Minute)
+	t.Cleanup(func() { _ = cache.Stop(context.Background()) })
+
+	keys := map[string][]byte{
+		"k1": []byte("0123456789abcdef-k1"),
+		"k2": []byte("0123456789abcdef-k2"),
+	}
+	i, err := NewIssuer(active, keys, cache, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create issuer: %v", err)
+	}
+	return i
+}
+
+func TestIssuer_MintVerify(t *testing.T) {
+	i := newTestIssuer(t, "k1", WithUses(2))
+
+	token, err := i.Mint(clientAddr)
+	if err != nil {
+		t.Fatalf("Failed to mint token: %v", err)
+	}
+	if !strings.HasPrefix(token, "k1.") {
+		t.Errorf("Expected token signed with k1, got %s", token)
+	}
+
+	// Another source port of the same client is fine with the ip binding.
+	for _, addr := range []string{clientAddr, "192.0.2.1:6000"} {
+		if err = i.Verify(token, addr); err != nil {
+			t.Errorf("Expected token to be valid for %s, got %v", addr, err)
+		}
+	}
+	if err = i.Verify(token, clientAddr); !errors.Is(err, ErrTokenExhausted) {
+		t.Errorf("Expected ErrTokenExhausted, got %v", err)
+	}
+}
+
+func TestIssuer_Expired(t *testing.T) {
+	i := newTestIssuer(t, "k1", WithTTL(time.Minute))
+	token, _ := i.Mint(clientAddr)
+
+	i.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := i.Verify(token, clientAddr); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestIssuer_SubjectMismatch(t *testing.T) {
+	i := newTestIssuer(t, "k1")
+	token, _ := i.Mint(clientAddr)
+
+	if err := i.Verify(token, otherAddr); !errors.Is(err, hashcash.ErrSubjectMismatch) {
+		t.Errorf("Expected ErrSubjectMismatch, got %v", err)
+	}
+
+	i.binding = hashcash.BindNone
+	if err := i.Verify(token, otherAddr); err != nil {
+		t.Errorf("Expected token to be valid without binding, got %v", err)
+	}
+}
+
+func TestIssuer_Tampered(t *testing.T) {
+	i := newTestIssuer(t, "k1")
+	token, _ := i.Mint(clientAddr)
+	parts := strings.Split(token, ".")
+
+	forged, _ := newTestIssuer(t, "k2").Mint(clientAddr)
+	forgedParts := strings.Split(forged, ".")
+
+	tests := map[string]string{
+		"malformed":   "garbage",
+		"unknown key": "k9." + parts[1] + "." + parts[2],
+		"payload":     parts[0] + "." + forgedParts[1] + "." + parts[2],
+		"mac":         parts[0] + "." + parts[1] + "." + forgedParts[2],
+	}
+	for name, tok := range tests {
+		if err := i.Verify(tok, clientAddr); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestIssuer_KeyRotation(t *testing.T) {
+	old := newTestIssuer(t, "k1")
+	token, _ := old.Mint(clientAddr)
+
+	rotated := newTestIssuer(t, "k2")
+	if err := rotated.Verify(token, clientAddr); err != nil {
+		t.Errorf("Expected token signed with retired key to be valid, got %v", err)
+	}
+}
+
+func TestNewIssuer_InvalidKeys(t *testing.T) {
+	cache := hashcash.NewMemoryCache(time.Minute)
+	defer cache.Stop(context.Background())
+
+	tests := map[string]map[string][]byte{
+		"empty":     {},
+		"short key": {"k1": []byte("short")},
+		"bad kid":   {"k.1": []byte("0123456789abcdef")},
+	}
+	for name, keys := range tests {
+		if _, err := NewIssuer("k1", keys, cache); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestAuthorizer_AuthorizeRequest(t *testing.T) {
+	i := newTestIssuer(t, "k1", WithUses(1))
+	a := NewAuthorizer(i, i.cache)
+
+	token, _ := a.Mint(clientAddr)
+
+	var rw bytes.Buffer
+	rw.WriteString("X-Token: " + token + "\n")
+	if err := a.AuthorizeRequest(context.Background(), auth.Request{ClientAddr: clientAddr}, &rw); err != nil {
+		t.Fatalf("Expected token line to be accepted, got %v", err)
+	}
+
+	req := auth.Request{ClientAddr: clientAddr, Token: token}
+	err := a.AuthorizeRequest(context.Background(), req, &rw)
+	if !errors.Is(err, auth.ErrUnauthorized) || !errors.Is(err, ErrTokenExhausted) {
+		t.Errorf("Expected unauthorized exhausted token, got %v", err)
+	}
+	if got := rw.String(); got != "X-Err: "+ErrTokenExhausted.Error()+"\n" {
+		t.Errorf("Expected rejection line, got %q", got)
+	}
+
+	rw.Reset()
+	rw.WriteString("X-Response: 1:20:...\n")
+	err = a.AuthorizeRequest(context.Background(), auth.Request{ClientAddr: clientAddr}, &rw)
+	if !errors.Is(err, auth.ErrProtoMismatch) {
+		t.Errorf("Expected ErrProtoMismatch, got %v", err)
+	}
+}
+
+func TestAuthorizer_SharedLineReader(t *testing.T) {
+	i := newTestIssuer(t, "k1")
+	a := NewAuthorizer(i, i.cache)
+
+	token, _ := a.Mint(clientAddr)
+
+	// The first request arrives together with the token, and the
+	// connection limits lines to what a token needs.
+	rw := strings.NewReader("X-Token: " + token + "\nX-Request: quote\n")
+	lines := proto.NewLineReader(rw, len("X-Token: ")+len(token))
+	req := auth.Request{ClientAddr: clientAddr, Lines: lines}
+	if err := a.AuthorizeRequest(context.Background(), req, nopWriter{rw}); err != nil {
+		t.Fatalf("Expected token line to be accepted, got %v", err)
+	}
+	if got, err := lines.ReadLine(context.Background()); err != nil || got != "X-Request: quote" {
+		t.Errorf("Expected the request line, got %q, %v", got, err)
+	}
+
+	rw = strings.NewReader("X-Token: " + token + "x\n")
+	req.Lines = proto.NewLineReader(rw, len("X-Token: ")+len(token))
+	err := a.AuthorizeRequest(context.Background(), req, nopWriter{rw})
+	if !errors.Is(err, auth.ErrProtoMismatch) {
+		t.Errorf("Expected ErrProtoMismatch for a line over the limit, got %v", err)
+	}
+}
+
+// nopWriter discards writes to a reader.
+type nopWriter struct {
+	io.Reader
+}
+
+func (nopWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -15,13 +15,26 @@ import (
 type App struct {
 	main    *Module
 	factory *build.Factory
+	// onRunning is called once all units have started.
+	onRunning []func()
 }
 
+// AppName is the name the app is provided under to the units it builds.
+const AppName = "app"
+
 func NewApp() *App {
-	return &App{
+	a := &App{
 		main:    NewModule("main"),
 		factory: build.NewFactory(),
 	}
+	a.Provide(AppName, a)
+	return a
+}
+
+// OnRunning registers fn to be called once the app is running, that is,
+// after every unit has started.
+func (a *App) OnRunning(fn func()) {
+	a.onRunning = append(a.onRunning, fn)
 }
 
 func (a *App) Provide(name string, item any) {
@@ -49,7 +62,7 @@ func (a *App) BuildUnits(builders ...UnitBuilder) error {
 			log.Error(err)
 			return err
 		}
-		a.main.AddItem(item)
+		a.main.AddNamedItem(b.Name, item)
 		a.Provide(b.Name, item)
 	}
 	return nil
@@ -71,7 +84,7 @@ func (a *App) Go(ctx context.Context) error {
 	select {
 	case err := <-errc:
 		if err != nil {
-			log.Error("Failed to start main module:", err)
+			log.Errorw("Failed to start main module", "error", err)
 			return fmt.Errorf("start app failed: %v", err)
 		}
 	case <-time.After(startTimeout):
@@ -81,6 +94,11 @@ func (a *App) Go(ctx context.Context) error {
 	}
 
 	log.Infof("App state: %s", a.main.State())
+	if a.main.State() == StateRunning {
+		for _, fn := range a.onRunning {
+			fn()
+		}
+	}
 
 	if err := a.wait(ctx); err != nil {
 		return fmt.Errorf("app runtime error: %v", err)
@@ -113,14 +131,14 @@ func (a *App) Stop(ctx context.Context) error {
 	log.Info("Stopping main module...")
 	err := a.main.Stop(ctx)
 	if err != nil {
-		log.Error("Failed to stop main module:", err)
+		log.Errorw("Failed to stop main module", "error", err)
 		return fmt.Errorf("main module stop failed: %v", err)
 	}
 
 	log.Info("Cleaning up resources...")
 	err = a.main.Cleanup(ctx)
 	if err != nil {
-		log.Error("Failed to clean up resources:", err)
+		log.Errorw("Failed to clean up resources", "error", err)
 		return fmt.Errorf("cleanup failed: %v", err)
 	}
 
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"wise-tcp/pkg/core/build"
+)
+
+type startedItem struct {
+	started bool
+}
+
+func (s *startedItem) Start(_ context.Context) error {
+	s.started = true
+	return nil
+}
+
+func TestApp_OnRunning(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	item := &startedItem{}
+	app := NewApp()
+	err := app.BuildUnits(UnitBuilder{Name: "item", Builder: func(_ *build.Injector) (any, error) { return item, nil }})
+	if err != nil {
+		t.Fatalf("Failed to build units: %v", err)
+	}
+
+	var state State
+	app.OnRunning(func() {
+		state = app.State()
+		if !item.started {
+			t.Error("Expected units to be started before OnRunning")
+		}
+		cancel()
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.Go(ctx) }()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("Failed to run app: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected OnRunning to be called")
+	}
+	if state != StateRunning {
+		t.Errorf("Expected state %s, got %s", StateRunning, state)
+	}
+}
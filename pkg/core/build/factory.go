@@ -0,0 +1,25 @@
+package build
+
+import "errors"
+
+// Factory builds items against a shared Injector.
+type Factory struct {
+	injector *Injector
+}
+
+func NewFactory() *Factory {
+	return &Factory{
+		injector: NewInjector(),
+	}
+}
+
+func (f *Factory) Injector() *Injector {
+	return f.injector
+}
+
+func (f *Factory) Build(b Builder) (any, error) {
+	if b == nil {
+		return nil, errors.New("builder must not be nil")
+	}
+	return b(f.injector)
+}
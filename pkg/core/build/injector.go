@@ -0,0 +1,269 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound     = errors.New("dependency not found")
+	ErrTypeMismatch = errors.New("dependency type mismatch")
+	ErrAmbiguous    = errors.New("ambiguous dependency")
+	ErrCycle        = errors.New("dependency cycle detected")
+)
+
+// Builder constructs an item, pulling its dependencies from the Injector.
+type Builder func(i *Injector) (any, error)
+
+// Injector is a registry of named and typed dependencies. Items can be
+// registered eagerly or as lazy builders resolved on first use; lazy
+// resolution tracks the chain of names being built to report cycles.
+type Injector struct {
+	*registry
+	// resolving is the chain of names being built when the Injector is
+	// handed to a builder. Every builder gets its own Injector over the
+	// shared registry, so concurrent resolutions keep separate chains.
+	resolving []string
+	// res is the resolution the chain belongs to; nil outside builders.
+	res *resolution
+}
+
+type registry struct {
+	mu    sync.RWMutex
+	named map[string]any
+	typed map[reflect.Type]any
+	lazy  map[string]Builder
+	// building holds the lazy items being built, so that concurrent
+	// extractions wait for the build instead of starting another.
+	building map[string]*pending
+}
+
+// pending is a lazy item being built by owner.
+type pending struct {
+	done  chan struct{}
+	item  any
+	err   error
+	owner *resolution
+}
+
+// resolution is an extraction together with the builds it runs.
+// waitsFor is set while it waits for another resolution's build, to find
+// cycles across resolutions.
+type resolution struct {
+	waitsFor *pending
+}
+
+// leadsTo reports whether waiting for p ends up waiting for res itself.
+// It must be called with the registry locked.
+func (p *pending) leadsTo(res *resolution) bool {
+	for p != nil {
+		if p.owner == res {
+			return true
+		}
+		p = p.owner.waitsFor
+	}
+	return false
+}
+
+func NewInjector() *Injector {
+	return &Injector{
+		registry: &registry{
+			named:    make(map[string]any),
+			typed:    make(map[reflect.Type]any),
+			lazy:     make(map[string]Builder),
+			building: make(map[string]*pending),
+		},
+	}
+}
+
+// Register stores item under name. The item is also indexed by its dynamic
+// type, so it can later be found with Resolve.
+func (i *Injector) Register(item any, name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.register(item, name)
+}
+
+func (r *registry) register(item any, name string) {
+	r.named[name] = item
+	delete(r.lazy, name)
+	if item != nil {
+		r.typed[reflect.TypeOf(item)] = item
+	}
+}
+
+// RegisterBuilder defers construction of name until it is first extracted.
+func (i *Injector) RegisterBuilder(name string, b Builder) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.named[name]; ok {
+		return
+	}
+	i.lazy[name] = b
+}
+
+// Has reports whether name is registered, either built or pending.
+func (i *Injector) Has(name string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if _, ok := i.named[name]; ok {
+		return true
+	}
+	_, ok := i.lazy[name]
+	return ok
+}
+
+// get returns the item registered under name, building it if it is
+// pending. found is false if name is not registered at all. A lazy item is
+// built once; extractions during the build wait for it.
+func (i *Injector) get(name string) (item any, found bool, err error) {
+	chain := append(append(make([]string, 0, len(i.resolving)+1), i.resolving...), name)
+	for _, n := range i.resolving {
+		if n == name {
+			return nil, true, fmt.Errorf("%w: %s", ErrCycle, strings.Join(chain, " -> "))
+		}
+	}
+	res := i.res
+	if res == nil {
+		res = &resolution{}
+	}
+
+	i.mu.Lock()
+	if item, ok := i.named[name]; ok {
+		i.mu.Unlock()
+		return item, true, nil
+	}
+	if p, ok := i.building[name]; ok {
+		if p.leadsTo(res) {
+			i.mu.Unlock()
+			return nil, true, fmt.Errorf("%w: %s", ErrCycle, strings.Join(chain, " -> "))
+		}
+		res.waitsFor = p
+		i.mu.Unlock()
+
+		<-p.done
+
+		i.mu.Lock()
+		res.waitsFor = nil
+		i.mu.Unlock()
+		return p.item, true, p.err
+	}
+	b, ok := i.lazy[name]
+	if !ok {
+		i.mu.Unlock()
+		return nil, false, nil
+	}
+	p := &pending{done: make(chan struct{}), owner: res}
+	i.building[name] = p
+	i.mu.Unlock()
+
+	item, err = b(&Injector{registry: i.registry, resolving: chain, res: res})
+	if err != nil {
+		item, err = nil, fmt.Errorf("failed to build %q: %w", name, err)
+	}
+
+	i.mu.Lock()
+	if err == nil {
+		i.register(item, name)
+	}
+	delete(i.building, name)
+	i.mu.Unlock()
+
+	p.item, p.err = item, err
+	close(p.done)
+	return item, true, err
+}
+
+// Provide registers item under the static type T, which may be an interface.
+func Provide[T any](i *Injector, item T) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.typed[reflect.TypeFor[T]()] = item
+}
+
+// Extract returns the item registered under name as T.
+func Extract[T any](i *Injector, name string) (T, error) {
+	var zero T
+
+	v, found, err := extract[T](i, name)
+	if err != nil {
+		return zero, err
+	}
+	if !found {
+		return zero, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return v, nil
+}
+
+func extract[T any](i *Injector, name string) (T, bool, error) {
+	var zero T
+
+	item, found, err := i.get(name)
+	if err != nil || !found {
+		return zero, found, err
+	}
+
+	v, ok := item.(T)
+	if !ok {
+		return zero, true, fmt.Errorf("%w: %q is %T, want %s", ErrTypeMismatch, name, item, reflect.TypeFor[T]())
+	}
+	return v, true, nil
+}
+
+// ExtractOptional behaves like Extract, but a missing name is not an error:
+// it yields the zero value and false. Type mismatches and cycles are still
+// reported. Whether name exists is decided by the same lookup that
+// returns it.
+func ExtractOptional[T any](i *Injector, name string) (T, bool, error) {
+	v, found, err := extract[T](i, name)
+	if err != nil {
+		return v, false, err
+	}
+	return v, found, nil
+}
+
+// Resolve returns the single item assignable to T. Items provided for T
+// directly take precedence over named registrations.
+func Resolve[T any](i *Injector) (T, error) {
+	var zero T
+	typ := reflect.TypeFor[T]()
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if item, ok := i.typed[typ]; ok {
+		if v, ok := item.(T); ok {
+			return v, nil
+		}
+	}
+
+	var (
+		found T
+		names []string
+	)
+	for name, item := range i.named {
+		if v, ok := item.(T); ok {
+			found = v
+			names = append(names, name)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return zero, fmt.Errorf("%w: no item of type %s", ErrNotFound, typ)
+	case 1:
+		return found, nil
+	default:
+		sort.Strings(names)
+		return zero, fmt.Errorf("%w: %d items of type %s: %s",
+			ErrAmbiguous, len(names), typ, strings.Join(names, ", "))
+	}
+}
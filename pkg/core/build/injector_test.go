@@ -0,0 +1,294 @@
+package build_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"wise-tcp/pkg/core/build"
+)
+
+type greeter interface {
+	Greet() string
+}
+
+type english struct{}
+
+func (english) Greet() string { return "hello" }
+
+func TestExtract_Named(t *testing.T) {
+	i := build.NewInjector()
+	i.Register(english{}, "greeter")
+
+	g, err := build.Extract[greeter](i, "greeter")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if g.Greet() != "hello" {
+		t.Errorf("expected hello, got %s", g.Greet())
+	}
+}
+
+func TestExtract_Missing(t *testing.T) {
+	i := build.NewInjector()
+
+	_, err := build.Extract[greeter](i, "missing")
+	if !errors.Is(err, build.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("expected error to name the dependency, got %v", err)
+	}
+}
+
+func TestExtract_TypeMismatch(t *testing.T) {
+	i := build.NewInjector()
+	i.Register(42, "number")
+
+	_, err := build.Extract[greeter](i, "number")
+	if !errors.Is(err, build.ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "int") {
+		t.Errorf("expected error to mention the actual type, got %v", err)
+	}
+}
+
+func TestExtractOptional(t *testing.T) {
+	i := build.NewInjector()
+
+	g, ok, err := build.ExtractOptional[greeter](i, "greeter")
+	if err != nil || ok || g != nil {
+		t.Fatalf("expected zero value without error, got %v, %v, %v", g, ok, err)
+	}
+
+	i.Register("not a greeter", "greeter")
+	_, ok, err = build.ExtractOptional[greeter](i, "greeter")
+	if !errors.Is(err, build.ErrTypeMismatch) || ok {
+		t.Fatalf("expected ErrTypeMismatch, got %v, %v", ok, err)
+	}
+
+	i.Register(english{}, "greeter")
+	g, ok, err = build.ExtractOptional[greeter](i, "greeter")
+	if err != nil || !ok || g == nil {
+		t.Fatalf("expected registered greeter, got %v, %v, %v", g, ok, err)
+	}
+}
+
+func TestRegisterBuilder_Lazy(t *testing.T) {
+	i := build.NewInjector()
+
+	calls := 0
+	i.RegisterBuilder("greeter", func(_ *build.Injector) (any, error) {
+		calls++
+		return english{}, nil
+	})
+
+	if calls != 0 {
+		t.Fatal("builder should not run before extraction")
+	}
+
+	for range 2 {
+		if _, err := build.Extract[greeter](i, "greeter"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected builder to run once, ran %d times", calls)
+	}
+}
+
+func TestRegisterBuilder_Cycle(t *testing.T) {
+	i := build.NewInjector()
+
+	i.RegisterBuilder("a", func(i *build.Injector) (any, error) {
+		return build.Extract[any](i, "b")
+	})
+	i.RegisterBuilder("b", func(i *build.Injector) (any, error) {
+		return build.Extract[any](i, "c")
+	})
+	i.RegisterBuilder("c", func(i *build.Injector) (any, error) {
+		return build.Extract[any](i, "a")
+	})
+
+	_, err := build.Extract[any](i, "a")
+	if !errors.Is(err, build.ErrCycle) {
+		t.Fatalf("expected ErrCycle, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("expected cycle path in error, got %v", err)
+	}
+
+	if _, err = build.Extract[any](i, "b"); !errors.Is(err, build.ErrCycle) {
+		t.Errorf("expected cycle to be reported again, got %v", err)
+	}
+}
+
+func TestRegisterBuilder_Concurrent(t *testing.T) {
+	for range 50 {
+		i := build.NewInjector()
+		i.RegisterBuilder("shared", func(_ *build.Injector) (any, error) {
+			time.Sleep(time.Millisecond)
+			return english{}, nil
+		})
+		for _, name := range []string{"a", "b"} {
+			i.RegisterBuilder(name, func(i *build.Injector) (any, error) {
+				return build.Extract[greeter](i, "shared")
+			})
+		}
+
+		// Resolving a and b at once is no cycle, although both chains
+		// pass through shared.
+		var wg sync.WaitGroup
+		errs := make(chan error, 2)
+		for _, name := range []string{"a", "b"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := build.Extract[greeter](i, name)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+}
+
+// instance is a greeter with an identity, to tell builds apart.
+type instance struct {
+	id int64
+}
+
+func (*instance) Greet() string { return "hello" }
+
+func TestExtract_ConcurrentBuildsOnce(t *testing.T) {
+	i := build.NewInjector()
+	var calls atomic.Int64
+	i.RegisterBuilder("shared", func(_ *build.Injector) (any, error) {
+		n := calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return &instance{id: n}, nil
+	})
+
+	const n = 8
+	got := make([]greeter, n)
+	var wg sync.WaitGroup
+	for k := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g, err := build.Extract[greeter](i, "shared")
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			got[k] = g
+		}()
+	}
+	wg.Wait()
+
+	if c := calls.Load(); c != 1 {
+		t.Errorf("expected builder to run once, ran %d times", c)
+	}
+	for k, g := range got {
+		if g != got[0] {
+			t.Errorf("extraction %d got another instance: %v", k, g)
+		}
+	}
+}
+
+func TestRegisterBuilder_ConcurrentCycle(t *testing.T) {
+	i := build.NewInjector()
+	for _, dep := range [][2]string{{"a", "b"}, {"b", "a"}} {
+		i.RegisterBuilder(dep[0], func(i *build.Injector) (any, error) {
+			// Both builds start before either extracts its dependency.
+			time.Sleep(10 * time.Millisecond)
+			return build.Extract[any](i, dep[1])
+		})
+	}
+
+	errs := make(chan error, 2)
+	for _, name := range []string{"a", "b"} {
+		go func() {
+			_, err := build.Extract[any](i, name)
+			errs <- err
+		}()
+	}
+	for range 2 {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, build.ErrCycle) {
+				t.Errorf("expected ErrCycle, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("concurrent cycle deadlocked")
+		}
+	}
+}
+
+func TestRegisterBuilder_Error(t *testing.T) {
+	i := build.NewInjector()
+	i.RegisterBuilder("broken", func(_ *build.Injector) (any, error) {
+		return nil, fmt.Errorf("boom")
+	})
+
+	_, err := build.Extract[any](i, "broken")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected builder error, got %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	i := build.NewInjector()
+
+	if _, err := build.Resolve[greeter](i); !errors.Is(err, build.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	i.Register(english{}, "en")
+	g, err := build.Resolve[greeter](i)
+	if err != nil || g.Greet() != "hello" {
+		t.Fatalf("expected greeter by type, got %v, %v", g, err)
+	}
+
+	i.Register(&english{}, "en2")
+	if _, err = build.Resolve[greeter](i); !errors.Is(err, build.ErrAmbiguous) {
+		t.Fatalf("expected ErrAmbiguous, got %v", err)
+	}
+
+	build.Provide[greeter](i, english{})
+	if _, err = build.Resolve[greeter](i); err != nil {
+		t.Fatalf("expected provided greeter to win, got %v", err)
+	}
+}
+
+func TestFactory_Build(t *testing.T) {
+	f := build.NewFactory()
+	f.Injector().Register(english{}, "greeter")
+
+	item, err := f.Build(func(i *build.Injector) (any, error) {
+		g, err := build.Extract[greeter](i, "greeter")
+		if err != nil {
+			return nil, err
+		}
+		return g.Greet() + " world", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item != "hello world" {
+		t.Errorf("expected 'hello world', got %v", item)
+	}
+
+	if _, err = f.Build(nil); err == nil {
+		t.Error("expected error for nil builder")
+	}
+}
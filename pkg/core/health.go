@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// HealthChecker is implemented by units that depend on services outside
+// the process, such as Redis, to report whether those are usable.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// Health is the readiness of an app, broken down by unit.
+type Health struct {
+	Ready bool         `json:"ready"`
+	State string       `json:"state"`
+	Units []UnitHealth `json:"units"`
+}
+
+type UnitHealth struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Health reports the app ready when it and all of its units are running
+// and every unit that checks its dependencies finds them healthy.
+func (a *App) Health(ctx context.Context) Health {
+	h := Health{
+		State: a.main.State().String(),
+		Units: a.main.health(ctx, ""),
+	}
+	h.Ready = a.main.State() == StateRunning
+	for _, u := range h.Units {
+		h.Ready = h.Ready && u.Ready
+	}
+	return h
+}
+
+// health checks the units of m and its submodules, whose unit names are
+// prefixed with the module name.
+func (m *Module) health(ctx context.Context, prefix string) []UnitHealth {
+	var units []UnitHealth
+	for _, u := range m.units {
+		uh := u.Health(ctx)
+		uh.Name = prefix + uh.Name
+		units = append(units, uh)
+	}
+	names := make([]string, 0, len(m.mods))
+	for name := range m.mods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		units = append(units, m.mods[name].health(ctx, prefix+name+"/")...)
+	}
+	return units
+}
+
+// Health checks the unit: it has to be running, and healthy if it is a
+// HealthChecker.
+func (u *Unit) Health(ctx context.Context) UnitHealth {
+	state := u.State()
+	h := UnitHealth{
+		Name:  u.Name(),
+		State: state.String(),
+		Ready: state == StateRunning,
+	}
+	if !h.Ready {
+		return h
+	}
+	if checker, ok := u.item.(HealthChecker); ok {
+		if err := checker.CheckHealth(ctx); err != nil {
+			h.Ready = false
+			h.Error = err.Error()
+		}
+	}
+	return h
+}
+
+// CheckHealth checks those of items that are HealthCheckers, for units
+// that delegate to the components they are made of.
+func CheckHealth(ctx context.Context, items ...any) error {
+	var errs []error
+	for _, item := range items {
+		if checker, ok := item.(HealthChecker); ok {
+			errs = append(errs, checker.CheckHealth(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
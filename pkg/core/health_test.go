@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"wise-tcp/pkg/core/build"
+)
+
+type checkedItem struct {
+	err error
+}
+
+func (c *checkedItem) CheckHealth(_ context.Context) error {
+	return c.err
+}
+
+func TestApp_Health(t *testing.T) {
+	ctx := context.Background()
+	redis := &checkedItem{}
+
+	app := NewApp()
+	err := app.BuildUnits(
+		UnitBuilder{Name: "plain", Builder: func(_ *build.Injector) (any, error) { return struct{}{}, nil }},
+		UnitBuilder{Name: "redis", Builder: func(_ *build.Injector) (any, error) { return redis, nil }},
+	)
+	if err != nil {
+		t.Fatalf("Failed to build units: %v", err)
+	}
+
+	if h := app.Health(ctx); h.Ready || h.State != "None" {
+		t.Errorf("Expected app not to be ready before start, got %+v", h)
+	}
+
+	if err = app.main.Init(ctx); err != nil {
+		t.Fatalf("Failed to init: %v", err)
+	}
+	if err = app.main.Start(ctx); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	h := app.Health(ctx)
+	if !h.Ready || len(h.Units) != 2 {
+		t.Fatalf("Expected ready app with 2 units, got %+v", h)
+	}
+	if h.Units[0].Name != "plain" || h.Units[0].State != "Running" {
+		t.Errorf("Expected running unit named plain, got %+v", h.Units[0])
+	}
+
+	redis.err = errors.New("connection refused")
+	h = app.Health(ctx)
+	if h.Ready {
+		t.Error("Expected failing health check to make the app unready")
+	}
+	if u := h.Units[1]; u.Ready || u.Error != "connection refused" {
+		t.Errorf("Expected redis unit to report its error, got %+v", u)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	err := CheckHealth(context.Background(), struct{}{}, &checkedItem{}, &checkedItem{err: errors.New("down")})
+	if err == nil || err.Error() != "down" {
+		t.Errorf("Expected the failing check to be reported, got %v", err)
+	}
+}
@@ -36,6 +36,11 @@ func (m *Module) AddItem(item interface{}) *Module {
 	return m
 }
 
+func (m *Module) AddNamedItem(name string, item interface{}) *Module {
+	m.units = append(m.units, NewNamedUnit(name, item))
+	return m
+}
+
 func (m *Module) AddModule(mod *Module) *Module {
 	m.mods[mod.Name()] = mod
 	return m
@@ -53,7 +58,7 @@ func (m *Module) Init(ctx context.Context) error {
 
 	for _, mod := range m.mods {
 		if err := mod.Init(ctx); err != nil {
-			log.Error("Failed to initialize module:", mod.Name(), err)
+			log.Errorw("Failed to initialize module", "module", mod.Name(), "error", err)
 			m.state.Set(StateError)
 			return err
 		}
@@ -61,7 +66,7 @@ func (m *Module) Init(ctx context.Context) error {
 
 	for _, unit := range m.units {
 		if err := unit.Init(ctx); err != nil {
-			log.Error("Failed to initialize unit:", err)
+			log.Errorw("Failed to initialize unit", "error", err)
 			m.state.Set(StateError)
 			return err
 		}
@@ -110,7 +115,7 @@ func (m *Module) Start(ctx context.Context) error {
 		if firstErr == nil {
 			firstErr = err
 		}
-		log.Error("Error during start:", err)
+		log.Errorw("Error during start", "error", err)
 	}
 
 	if firstErr != nil {
@@ -177,7 +182,7 @@ func (m *Module) Stop(ctx context.Context) error {
 			if firstErr == nil {
 				firstErr = err
 			}
-			log.Error("Error during module stop:", err)
+			log.Errorw("Error during module stop", "error", err)
 		}
 	}
 }
@@ -190,7 +195,7 @@ func (m *Module) Cleanup(ctx context.Context) error {
 
 	for _, unit := range m.units {
 		if err := unit.Cleanup(ctx); err != nil {
-			log.Error("Unit cleanup failed:", err)
+			log.Errorw("Unit cleanup failed", "error", err)
 			m.state.Set(StateError)
 			return err
 		}
@@ -198,7 +203,7 @@ func (m *Module) Cleanup(ctx context.Context) error {
 
 	for _, mod := range m.mods {
 		if err := mod.Cleanup(ctx); err != nil {
-			log.Error("Module cleanup failed:", mod.Name(), err)
+			log.Errorw("Module cleanup failed", "module", mod.Name(), "error", err)
 			m.state.Set(StateError)
 			return err
 		}
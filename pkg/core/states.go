@@ -37,6 +37,8 @@ func (l *stateLock) Set(state State) {
 }
 
 func (l *stateLock) Get() State {
+	l.Lock()
+	defer l.Unlock()
 	return l.state
 }
 
@@ -9,6 +9,7 @@ import (
 
 type Unit struct {
 	state stateLock
+	name  string
 	item  interface{}
 }
 
@@ -19,6 +20,13 @@ func NewUnit(item interface{}) *Unit {
 	}
 }
 
+// NewNamedUnit creates a unit reported under name, e.g. in health checks.
+func NewNamedUnit(name string, item interface{}) *Unit {
+	u := NewUnit(item)
+	u.name = name
+	return u
+}
+
 func (u *Unit) Init(ctx context.Context) error {
 	if u.state.Get() != StateNone {
 		return errors.New("unit already initialized or in invalid state")
@@ -111,3 +119,11 @@ func (u *Unit) Cleanup(ctx context.Context) error {
 func (u *Unit) State() State {
 	return u.state.Get()
 }
+
+// Name returns the name the unit was created with, or the type of its item.
+func (u *Unit) Name() string {
+	if u.name != "" {
+		return u.name
+	}
+	return fmt.Sprintf("%T", u.item)
+}
@@ -0,0 +1,39 @@
+// Package handoff passes listening sockets from a running process to a
+// freshly started copy of itself, so the binary can be replaced without
+// closing the ports.
+//
+// The parent starts the child with the sockets as inherited file
+// descriptors, starting at 3, and names them in an environment variable.
+// The child builds its listeners from them and reports readiness over a
+// pipe; only then does the parent stop accepting and drain. Handoff needs
+// a Unix system; elsewhere no socket is ever inherited and Restart fails.
+package handoff
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	// envListeners lists the names of the inherited sockets in descriptor
+	// order, separated by commas.
+	envListeners = "WISE_LISTEN_FDS"
+	// envReady holds the descriptor of the pipe the child reports on.
+	envReady = "WISE_READY_FD"
+
+	// firstFD is the first descriptor after stdin, stdout and stderr.
+	firstFD = 3
+)
+
+var (
+	ErrNotReady = errors.New("child process did not become ready")
+	// ErrUnsupported is returned by Restart on platforms that cannot pass
+	// descriptors to a child process.
+	ErrUnsupported = errors.New("socket handoff is not supported on this platform")
+)
+
+// Filer is implemented by listeners that can hand out their descriptor,
+// such as *net.TCPListener and *net.UnixListener.
+type Filer interface {
+	File() (*os.File, error)
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package handoff
+
+import (
+	"net"
+	"time"
+)
+
+// Listener never finds an inherited socket on this platform.
+func Listener(string) (net.Listener, bool, error) {
+	return nil, false, nil
+}
+
+// Ready is a no-op on this platform.
+func Ready() error {
+	return nil
+}
+
+// Restart fails with ErrUnsupported on this platform.
+func Restart(map[string]Filer, time.Duration) (int, error) {
+	return 0, ErrUnsupported
+}
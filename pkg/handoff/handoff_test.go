@@ -0,0 +1,91 @@
+//go:build unix
+
+package handoff
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+const envFail = "HANDOFF_TEST_FAIL"
+
+// TestMain doubles as the child process started by Restart.
+func TestMain(m *testing.M) {
+	if os.Getenv(envReady) != "" {
+		runChild()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runChild() {
+	if os.Getenv(envFail) != "" {
+		os.Exit(1)
+	}
+	ln, ok, err := Listener("test")
+	if err != nil || !ok {
+		os.Exit(2)
+	}
+	if err = Ready(); err != nil {
+		os.Exit(3)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	_, _ = conn.Write([]byte("child\n"))
+	_ = conn.Close()
+	os.Exit(0)
+}
+
+func TestRestart(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	pid, err := Restart(map[string]Filer{"test": ln.(*net.TCPListener)}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if pid == 0 || pid == os.Getpid() {
+		t.Errorf("Expected child pid, got %d", pid)
+	}
+	// The port stays open after the parent lets go of it.
+	_ = ln.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial handed off listener: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read from child: %v", err)
+	}
+	if line != "child\n" {
+		t.Errorf("Expected child to answer, got %q", line)
+	}
+}
+
+func TestRestart_ChildFails(t *testing.T) {
+	t.Setenv(envFail, "1")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	_, err = Restart(map[string]Filer{"test": ln.(*net.TCPListener)}, 5*time.Second)
+	if !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected ErrNotReady, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+//go:build unix
+
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	inheritOnce sync.Once
+	inherited   map[string]*os.File
+)
+
+func loadInherited() {
+	inherited = make(map[string]*os.File)
+	names := os.Getenv(envListeners)
+	if names == "" {
+		return
+	}
+	for i, name := range strings.Split(names, ",") {
+		inherited[name] = os.NewFile(uintptr(firstFD+i), name)
+	}
+}
+
+// Listener returns the socket named name if it was inherited from the
+// parent process, and false otherwise. Each socket can be taken once.
+func Listener(name string) (net.Listener, bool, error) {
+	inheritOnce.Do(loadInherited)
+
+	f, ok := inherited[name]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(inherited, name)
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to use inherited socket %s: %w", name, err)
+	}
+	return ln, true, nil
+}
+
+// Ready tells the parent that the inherited sockets are being served and
+// closes those no listener asked for. It is a no-op in a process that was
+// not started by Restart.
+func Ready() error {
+	inheritOnce.Do(loadInherited)
+	for name, f := range inherited {
+		_ = f.Close()
+		delete(inherited, name)
+	}
+
+	fd := os.Getenv(envReady)
+	if fd == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", envReady, fd, err)
+	}
+	_ = os.Unsetenv(envReady)
+
+	f := os.NewFile(uintptr(n), "ready")
+	defer f.Close()
+	if _, err = f.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to notify parent: %w", err)
+	}
+	return nil
+}
+
+// Restart starts a copy of the running binary with the same arguments,
+// hands it the listeners and waits up to timeout for it to report ready.
+// On failure the child is killed and the caller keeps serving.
+func Restart(listeners map[string]Filer, timeout time.Duration) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	names := make([]string, 0, len(listeners))
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for name, l := range listeners {
+		f, err := l.File()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get descriptor of %s: %w", name, err)
+		}
+		names = append(names, name)
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(environ(),
+		envListeners+"="+strings.Join(names, ","),
+		envReady+"="+strconv.Itoa(firstFD+len(names)),
+	)
+	if err = cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start child process: %w", err)
+	}
+	// Only the child may hold the write end, so that its exit is seen as
+	// EOF.
+	_ = w.Close()
+	files = files[:len(files)-1]
+
+	if err = waitReady(r, timeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, err
+	}
+
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+	return pid, nil
+}
+
+func waitReady(r *os.File, timeout time.Duration) error {
+	if err := r.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("failed to set ready deadline: %w", err)
+	}
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("%w within %v", ErrNotReady, timeout)
+		}
+		return fmt.Errorf("%w: %w", ErrNotReady, err)
+	}
+	return nil
+}
+
+// environ returns the environment without the variables of a previous
+// handoff.
+func environ() []string {
+	env := os.Environ()
+	out := env[:0:0]
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envListeners+"=") || strings.HasPrefix(kv, envReady+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
@@ -0,0 +1,68 @@
+package handoff
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]net.Listener)
+)
+
+// Name returns the name a socket is handed over under.
+func Name(network, address string) string {
+	return network + "://" + address
+}
+
+// Listen takes over the socket for network and address from the previous
+// process, or creates it, and registers it to be handed over by the next
+// restart. inherited reports which of the two happened.
+func Listen(network, address string) (ln net.Listener, inherited bool, err error) {
+	name := Name(network, address)
+	ln, inherited, err = Listener(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if !inherited {
+		if ln, err = net.Listen(network, address); err != nil {
+			return nil, false, fmt.Errorf("failed to listen on %s: %w", name, err)
+		}
+	}
+	Register(name, ln)
+	return ln, inherited, nil
+}
+
+// Register adds a socket to those handed over by the next restart. The
+// listener must implement Filer by then.
+func Register(name string, ln net.Listener) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = ln
+}
+
+// Unregister removes a socket, typically when its listener is closed.
+func Unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(registry, name)
+}
+
+// Registered returns the sockets to hand over, by name.
+func Registered() (map[string]Filer, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	files := make(map[string]Filer, len(registry))
+	for name, ln := range registry {
+		f, ok := ln.(Filer)
+		if !ok {
+			return nil, fmt.Errorf("listener %s cannot be handed off", name)
+		}
+		files[name] = f
+	}
+	return files, nil
+}
@@ -0,0 +1,37 @@
+package handoff
+
+import "testing"
+
+func TestListener_NotInherited(t *testing.T) {
+	if _, ok, err := Listener("missing"); ok || err != nil {
+		t.Errorf("Expected no inherited listener, got %v %v", ok, err)
+	}
+	if err := Ready(); err != nil {
+		t.Errorf("Expected Ready to be a no-op, got %v", err)
+	}
+}
+
+func TestListen_Registers(t *testing.T) {
+	ln, inherited, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	if inherited {
+		t.Error("Expected a new socket without a parent process")
+	}
+
+	name := Name("tcp", "127.0.0.1:0")
+	files, err := Registered()
+	if err != nil {
+		t.Fatalf("Failed to get registered sockets: %v", err)
+	}
+	if _, ok := files[name]; !ok {
+		t.Errorf("Expected %s to be registered, got %v", name, files)
+	}
+
+	Unregister(name)
+	if files, _ = Registered(); len(files) != 0 {
+		t.Errorf("Expected no registered sockets, got %v", files)
+	}
+}
@@ -0,0 +1,55 @@
+package log
+
+import (
+	"context"
+	"sort"
+)
+
+// Fields are key-value pairs attached to every line of a logger, such as
+// the ID of the connection being served.
+type Fields map[string]interface{}
+
+// keysAndValues returns the fields as alternating keys and values, sorted
+// by key.
+func (f Fields) keysAndValues() []interface{} {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kv = append(kv, k, f[k])
+	}
+	return kv
+}
+
+type ctxKey struct{}
+
+// WithFields returns the default logger with fields added.
+func WithFields(fields Fields) Logger {
+	return withFields(Default(), fields)
+}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(ctxKey{}).(Logger); ok {
+		return l
+	}
+	return Default()
+}
+
+// ContextWithFields returns a copy of ctx whose logger has fields added.
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	return NewContext(ctx, withFields(FromContext(ctx), fields))
+}
+
+func withFields(l Logger, fields Fields) Logger {
+	return l.With(fields.keysAndValues()...)
+}
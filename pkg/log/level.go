@@ -0,0 +1,203 @@
+package log
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is the severity of a log entry. Loggers drop entries below their
+// level.
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int8(l))
+	}
+}
+
+// MarshalText encodes the level by its lowercase name, so that levels read
+// well in JSON and YAML.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(l.String())), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ParseLevel parses a level name such as "info" or "WARN".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Levels holds a default level and per-component overrides, both of which
+// can change while loggers use them. A component without an override
+// takes the level of its closest parent: "server.pow" falls back to
+// "server", then to the default.
+type Levels struct {
+	mu    sync.Mutex
+	state atomic.Pointer[levelState]
+}
+
+// levelState is replaced as a whole on every change, so that reading the
+// levels takes no lock.
+type levelState struct {
+	def        Level
+	components map[string]Level
+	// min is the lowest of all levels, for a quick check.
+	min Level
+}
+
+func NewLevels(def Level) *Levels {
+	l := &Levels{}
+	l.store(def, nil)
+	return l
+}
+
+var defaultLevels = NewLevels(LevelInfo)
+
+// DefaultLevels returns the levels the backends filter by unless told
+// otherwise.
+func DefaultLevels() *Levels {
+	return defaultLevels
+}
+
+// SetLevel sets the default level of the default levels.
+func SetLevel(level Level) {
+	defaultLevels.SetLevel(level)
+}
+
+// SetComponentLevel sets the level of a component of the default levels.
+func SetComponentLevel(name string, level Level) {
+	defaultLevels.SetComponentLevel(name, level)
+}
+
+func (l *Levels) store(def Level, components map[string]Level) {
+	min := def
+	for _, lvl := range components {
+		if lvl < min {
+			min = lvl
+		}
+	}
+	l.state.Store(&levelState{def: def, components: components, min: min})
+}
+
+// Enabled reports whether an entry at level is logged for the named
+// component; an empty name is the default.
+func (l *Levels) Enabled(name string, level Level) bool {
+	s := l.state.Load()
+	if level < s.min {
+		return false
+	}
+	return level >= s.level(name)
+}
+
+// Min returns the lowest level any component logs at.
+func (l *Levels) Min() Level {
+	return l.state.Load().min
+}
+
+// Level returns the level of the named component.
+func (l *Levels) Level(name string) Level {
+	return l.state.Load().level(name)
+}
+
+func (s *levelState) level(name string) Level {
+	for name != "" {
+		if lvl, ok := s.components[name]; ok {
+			return lvl
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return s.def
+}
+
+// Get returns the default level and a copy of the component overrides.
+func (l *Levels) Get() (Level, map[string]Level) {
+	s := l.state.Load()
+	return s.def, maps.Clone(s.components)
+}
+
+func (l *Levels) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.store(level, l.state.Load().components)
+}
+
+func (l *Levels) SetComponentLevel(name string, level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.state.Load()
+	components := maps.Clone(s.components)
+	if components == nil {
+		components = make(map[string]Level)
+	}
+	components[name] = level
+	l.store(s.def, components)
+}
+
+// UnsetComponentLevel removes the override of a component, which then
+// takes the level of its parent again.
+func (l *Levels) UnsetComponentLevel(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.state.Load()
+	components := maps.Clone(s.components)
+	delete(components, name)
+	l.store(s.def, components)
+}
+
+// Set replaces the default level and all component overrides.
+func (l *Levels) Set(def Level, components map[string]Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.store(def, maps.Clone(components))
+}
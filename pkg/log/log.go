@@ -1,9 +1,13 @@
 package log
 
 import (
-	"sync"
+	"sync/atomic"
 )
 
+// Logger is a leveled logger. The plain methods join their arguments like
+// fmt.Sprint, the f methods format like fmt.Sprintf, and the w methods log
+// msg with alternating keys and values, which backends keep as structured
+// fields.
 type Logger interface {
 	Info(args ...interface{})
 	Warn(args ...interface{})
@@ -15,59 +19,106 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 	Debugf(format string, args ...interface{})
 	Fatalf(format string, args ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+	Debugw(msg string, keysAndValues ...interface{})
+	Fatalw(msg string, keysAndValues ...interface{})
+	// With returns a child logger that adds keysAndValues to every entry.
+	With(keysAndValues ...interface{}) Logger
+	// Named returns a child logger for the named component, whose level
+	// can be set apart from the rest. Names of nested children are joined
+	// with dots.
+	Named(name string) Logger
 }
 
-var (
-	defaultLogger Logger = &stdLogger{}
-	once          sync.Once
-)
+// holder lets loggers of different types share an atomic.Pointer.
+type holder struct {
+	Logger
+}
+
+var defaultLogger atomic.Pointer[holder]
+
+func init() {
+	SetLogger(&stdLogger{})
+}
 
+// SetLogger replaces the default logger. Loggers already derived from the
+// previous one, such as those carried in contexts, keep using it.
 func SetLogger(l Logger) {
-	once.Do(func() {
-		defaultLogger = l
-	})
+	defaultLogger.Store(&holder{l})
 }
 
 func Default() Logger {
-	return defaultLogger
+	return defaultLogger.Load().Logger
+}
+
+// Named returns the default logger for the named component.
+func Named(name string) Logger {
+	return Default().Named(name)
 }
 
 func Info(args ...interface{}) {
-	defaultLogger.Info(args...)
+	Default().Info(args...)
 }
 
 func Warn(args ...interface{}) {
-	defaultLogger.Warn(args...)
+	Default().Warn(args...)
 }
 
 func Error(args ...interface{}) {
-	defaultLogger.Error(args...)
+	Default().Error(args...)
 }
 
 func Debug(args ...interface{}) {
-	defaultLogger.Debug(args...)
+	Default().Debug(args...)
 }
 
 func Fatal(args ...interface{}) {
-	defaultLogger.Fatal(args...)
+	Default().Fatal(args...)
 }
 
 func Infof(format string, args ...interface{}) {
-	defaultLogger.Infof(format, args...)
+	Default().Infof(format, args...)
 }
 
 func Warnf(format string, args ...interface{}) {
-	defaultLogger.Warnf(format, args...)
+	Default().Warnf(format, args...)
 }
 
 func Errorf(format string, args ...interface{}) {
-	defaultLogger.Errorf(format, args...)
+	Default().Errorf(format, args...)
 }
 
 func Debugf(format string, args ...interface{}) {
-	defaultLogger.Debugf(format, args...)
+	Default().Debugf(format, args...)
 }
 
 func Fatalf(format string, args ...interface{}) {
-	defaultLogger.Fatalf(format, args...)
+	Default().Fatalf(format, args...)
+}
+
+func Infow(msg string, keysAndValues ...interface{}) {
+	Default().Infow(msg, keysAndValues...)
+}
+
+func Warnw(msg string, keysAndValues ...interface{}) {
+	Default().Warnw(msg, keysAndValues...)
+}
+
+func Errorw(msg string, keysAndValues ...interface{}) {
+	Default().Errorw(msg, keysAndValues...)
+}
+
+func Debugw(msg string, keysAndValues ...interface{}) {
+	Default().Debugw(msg, keysAndValues...)
+}
+
+func Fatalw(msg string, keysAndValues ...interface{}) {
+	Default().Fatalw(msg, keysAndValues...)
+}
+
+// With returns the default logger with keysAndValues added.
+func With(keysAndValues ...interface{}) Logger {
+	return Default().With(keysAndValues...)
 }
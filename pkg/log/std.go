@@ -3,74 +3,170 @@ package log
 import (
 	"fmt"
 	"log"
+	"os"
+	"strings"
 )
 
+// stdLogger writes through the standard library logger. Fields added with
+// With are appended to each line as "key=value" pairs.
 type stdLogger struct {
+	// levels filters the entries; nil means DefaultLevels.
+	levels      *Levels
+	name        string
 	exitHandler exitFunc
+	// fields holds the fields added with With, as formatted by formatKV.
+	fields string
 }
 
 type exitFunc func(code int)
 
-type logLevel string
+// NewStdLogger returns a logger writing through the standard library
+// logger that filters entries by levels.
+func NewStdLogger(levels *Levels) Logger {
+	return &stdLogger{levels: levels}
+}
 
-const (
-	levelInfo  logLevel = "INFO"
-	levelWarn  logLevel = "WARN"
-	levelDebug logLevel = "DEBUG"
-	levelError logLevel = "ERROR"
-	levelFatal logLevel = "FATAL"
-)
+func (l *stdLogger) With(keysAndValues ...interface{}) Logger {
+	child := *l
+	child.fields += formatKV(keysAndValues)
+	return &child
+}
+
+// Named returns a child logger for the named component, which is logged
+// as the "logger" field ahead of the others.
+func (l *stdLogger) Named(name string) Logger {
+	child := *l
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child.name = name
+	return &child
+}
+
+func (l *stdLogger) enabled(level Level) bool {
+	levels := l.levels
+	if levels == nil {
+		levels = defaultLevels
+	}
+	return level == LevelFatal || levels.Enabled(l.name, level)
+}
 
 func (l *stdLogger) Info(args ...interface{}) {
-	l.log(levelInfo, args...)
+	l.log(LevelInfo, args...)
 }
 
 func (l *stdLogger) Warn(args ...interface{}) {
-	l.log(levelWarn, args...)
+	l.log(LevelWarn, args...)
 }
 
 func (l *stdLogger) Error(args ...interface{}) {
-	l.log(levelError, args...)
+	l.log(LevelError, args...)
 }
 
 func (l *stdLogger) Debug(args ...interface{}) {
-	l.log(levelDebug, args...)
+	l.log(LevelDebug, args...)
 }
 
 func (l *stdLogger) Fatal(args ...interface{}) {
-	l.log(levelFatal, args...)
-	l.exitHandler(1)
+	l.log(LevelFatal, args...)
+	l.exit()
 }
 
 func (l *stdLogger) Infof(format string, args ...interface{}) {
-	l.logf(levelInfo, format, args...)
+	l.logf(LevelInfo, format, args...)
 }
 
 func (l *stdLogger) Warnf(msg string, args ...interface{}) {
-	l.logf(levelWarn, msg, args...)
+	l.logf(LevelWarn, msg, args...)
 }
 
 func (l *stdLogger) Errorf(format string, args ...interface{}) {
-	l.logf(levelError, format, args...)
+	l.logf(LevelError, format, args...)
 }
 
 func (l *stdLogger) Debugf(format string, args ...interface{}) {
-	l.logf(levelDebug, format, args...)
+	l.logf(LevelDebug, format, args...)
 }
 
 func (l *stdLogger) Fatalf(format string, args ...interface{}) {
-	l.logf(levelFatal, format, args...)
-	l.exitHandler(1)
+	l.logf(LevelFatal, format, args...)
+	l.exit()
+}
+
+func (l *stdLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.logw(LevelInfo, msg, keysAndValues)
+}
+
+func (l *stdLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.logw(LevelWarn, msg, keysAndValues)
+}
+
+func (l *stdLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.logw(LevelError, msg, keysAndValues)
+}
+
+func (l *stdLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.logw(LevelDebug, msg, keysAndValues)
 }
 
-func (l *stdLogger) log(level logLevel, args ...interface{}) {
-	message := "[" + string(level) + "]"
+func (l *stdLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.logw(LevelFatal, msg, keysAndValues)
+	l.exit()
+}
+
+func (l *stdLogger) log(level Level, args ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	message := "[" + level.String() + "]"
 	for _, arg := range args {
 		message += fmt.Sprintf(" %v", arg)
 	}
-	log.Print(message)
+	log.Print(message + l.suffix())
+}
+
+func (l *stdLogger) logf(level Level, format string, args ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "["+level.String()+"] "+format, args...)
+	log.Print(sb.String() + l.suffix())
+}
+
+func (l *stdLogger) logw(level Level, msg string, keysAndValues []interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	log.Print("[" + level.String() + "] " + msg + l.suffix() + formatKV(keysAndValues))
+}
+
+// suffix returns the component name and fields to append to a line.
+func (l *stdLogger) suffix() string {
+	if l.name == "" {
+		return l.fields
+	}
+	return " logger=" + l.name + l.fields
 }
 
-func (l *stdLogger) logf(level logLevel, format string, args ...interface{}) {
-	log.Printf("["+string(level)+"] "+format, args...)
+func (l *stdLogger) exit() {
+	if l.exitHandler != nil {
+		l.exitHandler(1)
+		return
+	}
+	os.Exit(1)
+}
+
+// formatKV renders alternating keys and values as " key=value" pairs. A
+// value without a key is logged under "!BADKEY", as log/slog does.
+func formatKV(keysAndValues []interface{}) string {
+	var sb strings.Builder
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 == len(keysAndValues) {
+			fmt.Fprintf(&sb, " !BADKEY=%v", keysAndValues[i])
+			break
+		}
+		fmt.Fprintf(&sb, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	return sb.String()
 }
@@ -2,7 +2,9 @@ package log
 
 import (
 	"bytes"
+	"context"
 	std "log"
+	"strings"
 	"testing"
 )
 
@@ -11,7 +13,7 @@ func setupTestLogger() (stdLogger, *bytes.Buffer) {
 	std.SetOutput(&output)
 	std.SetFlags(0)
 
-	logger := stdLogger{}
+	logger := stdLogger{levels: NewLevels(LevelDebug)}
 
 	return logger, &output
 }
@@ -138,3 +140,103 @@ func TestDefaultLogger_FormatMismatch(t *testing.T) {
 	logger.Warnf("warn with args: %d")
 	assertLogOutput(t, output.String(), "[WARN] warn with args: %!d(MISSING)\n")
 }
+
+func TestWithFields(t *testing.T) {
+	_, output := setupTestLogger()
+	l := withFields(&stdLogger{}, Fields{"conn": 7, "addr": "192.0.2.1:5000"})
+
+	l.Info("accepted")
+	assertLogOutput(t, output.String(), "[INFO] accepted addr=192.0.2.1:5000 conn=7\n")
+	output.Reset()
+
+	withFields(l, Fields{"phase": "auth"}).Warnf("unauthorized: %s", "invalid solution")
+	assertLogOutput(t, output.String(), "[WARN] unauthorized: invalid solution addr=192.0.2.1:5000 conn=7 phase=auth\n")
+}
+
+func TestFromContext(t *testing.T) {
+	_, output := setupTestLogger()
+	ctx := context.Background()
+
+	if FromContext(ctx) != Default() {
+		t.Error("Expected default logger without a logger in context")
+	}
+
+	ctx = NewContext(ctx, &stdLogger{})
+	ctx = ContextWithFields(ctx, Fields{"conn": 1})
+	ctx = ContextWithFields(ctx, Fields{"difficulty": 20})
+	FromContext(ctx).Error("failed")
+	assertLogOutput(t, output.String(), "[ERROR] failed conn=1 difficulty=20\n")
+}
+
+func TestStdLogger_With(t *testing.T) {
+	_, output := setupTestLogger()
+	l := (&stdLogger{}).With("conn", 7)
+
+	l.Infow("accepted", "addr", "192.0.2.1:5000", "phase")
+	assertLogOutput(t, output.String(), "[INFO] accepted conn=7 addr=192.0.2.1:5000 !BADKEY=phase\n")
+	output.Reset()
+
+	l.With("phase", "auth").Errorw("rejected", "reason", "invalid solution")
+	assertLogOutput(t, output.String(), "[ERROR] rejected conn=7 phase=auth reason=invalid solution\n")
+}
+
+func TestStdLogger_Level(t *testing.T) {
+	_, output := setupTestLogger()
+	l := NewStdLogger(NewLevels(LevelWarn)).With("conn", 1)
+
+	l.Debug("debug")
+	l.Infof("info %d", 1)
+	l.Infow("info")
+	l.Warnw("warn")
+	assertLogOutput(t, output.String(), "[WARN] warn conn=1\n")
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, lvl := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelFatal} {
+		got, err := ParseLevel(strings.ToLower(lvl.String()))
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", lvl, err)
+		}
+		if got != lvl {
+			t.Errorf("Expected %s, got %s", lvl, got)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestStdLogger_ComponentLevels(t *testing.T) {
+	_, output := setupTestLogger()
+	levels := NewLevels(LevelInfo)
+	root := NewStdLogger(levels)
+	srv := root.Named("server")
+	pow := srv.Named("pow")
+
+	pow.Debug("hidden")
+	levels.SetComponentLevel("server", LevelDebug)
+	pow.Debug("shown")
+	root.Debug("hidden")
+	assertLogOutput(t, output.String(), "[DEBUG] shown logger=server.pow\n")
+	output.Reset()
+
+	// The closest override wins, and removing it restores the parent's.
+	levels.SetComponentLevel("server.pow", LevelError)
+	pow.Warn("hidden")
+	srv.Debug("shown")
+	levels.UnsetComponentLevel("server.pow")
+	pow.With("conn", 1).Warn("shown")
+	assertLogOutput(t, output.String(), "[DEBUG] shown logger=server\n[WARN] shown logger=server.pow conn=1\n")
+}
+
+func TestSetLogger(t *testing.T) {
+	prev := Default()
+	t.Cleanup(func() { SetLogger(prev) })
+
+	_, output := setupTestLogger()
+	for _, l := range []Logger{NewStdLogger(NewLevels(LevelError)), NewStdLogger(NewLevels(LevelInfo))} {
+		SetLogger(l)
+		Info("info")
+	}
+	assertLogOutput(t, output.String(), "[INFO] info\n")
+}
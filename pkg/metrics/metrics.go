@@ -0,0 +1,341 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry the package level constructors register
+// with.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return defaultRegistry.Counter(name, help, labels...)
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return defaultRegistry.Gauge(name, help, labels...)
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return defaultRegistry.Histogram(name, help, buckets)
+}
+
+func NewGaugeFunc(name, help string, fn func() float64) {
+	defaultRegistry.GaugeFunc(name, help, fn)
+}
+
+type metric interface {
+	kind() string
+	write(w *bufio.Writer, name string)
+}
+
+type entry struct {
+	help string
+	m    metric
+}
+
+// Registry is a set of named metrics. Registering a name again returns the
+// metric already registered under it, so that packages can declare their
+// metrics once and builders can run more than once.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]*entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*entry)}
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return register(r, name, help, func() *Counter {
+		return &Counter{newSeries(labels)}
+	})
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return register(r, name, help, func() *Gauge {
+		return &Gauge{newSeries(labels)}
+	})
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return register(r, name, help, func() *Histogram {
+		b := append([]float64(nil), buckets...)
+		sort.Float64s(b)
+		return &Histogram{buckets: b, counts: make([]uint64, len(b))}
+	})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn when the metrics
+// are written. Registering the name again replaces fn.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.metrics[name]; ok {
+		if _, ok = e.m.(gaugeFunc); !ok {
+			panic(fmt.Sprintf("metrics: %s is already registered as a %s", name, e.m.kind()))
+		}
+	}
+	r.metrics[name] = &entry{help: help, m: gaugeFunc(fn)}
+}
+
+func register[M metric](r *Registry, name, help string, create func() M) M {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.metrics[name]; ok {
+		m, ok := e.m.(M)
+		if !ok {
+			panic(fmt.Sprintf("metrics: %s is already registered as a %s", name, e.m.kind()))
+		}
+		return m
+	}
+	m := create()
+	r.metrics[name] = &entry{help: help, m: m}
+	return m
+}
+
+// WriteTo writes all metrics, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	entries := make([]*entry, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		entries[i] = r.metrics[name]
+	}
+	r.mu.RUnlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for i, e := range entries {
+		fmt.Fprintf(bw, "# HELP %s %s\n", names[i], escapeHelp(e.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", names[i], e.m.kind())
+		e.m.write(bw, names[i])
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_, _ = r.WriteTo(w)
+}
+
+// series holds the values of a metric by label values.
+type series struct {
+	labels []string
+	mu     sync.Mutex
+	values map[string]*value
+}
+
+type value struct {
+	labels []string
+	v      float64
+}
+
+func newSeries(labels []string) series {
+	return series{labels: labels, values: make(map[string]*value)}
+}
+
+func (s *series) add(delta float64, labelValues []string) {
+	s.update(labelValues, func(v *value) { v.v += delta })
+}
+
+func (s *series) update(labelValues []string, fn func(v *value)) {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(s.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	if !ok {
+		v = &value{labels: append([]string(nil), labelValues...)}
+		s.values[key] = v
+	}
+	fn(v)
+}
+
+func (s *series) write(w *bufio.Writer, name string) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]value, len(keys))
+	for i, k := range keys {
+		values[i] = *s.values[k]
+	}
+	s.mu.Unlock()
+
+	// A metric without labels is reported as zero before its first update.
+	if len(s.labels) == 0 && len(values) == 0 {
+		values = append(values, value{})
+	}
+	for _, v := range values {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(s.labels, v.labels), formatFloat(v.v))
+	}
+}
+
+// Counter is a monotonically increasing value per set of label values.
+type Counter struct {
+	series
+}
+
+func (c *Counter) kind() string { return "counter" }
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add adds delta, which must not be negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.add(delta, labelValues)
+}
+
+// Gauge is a value per set of label values that can go up and down.
+type Gauge struct {
+	series
+}
+
+func (g *Gauge) kind() string { return "gauge" }
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(val *value) { val.v = v })
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.add(delta, labelValues)
+}
+
+type gaugeFunc func() float64
+
+func (f gaugeFunc) kind() string { return "gauge" }
+
+func (f gaugeFunc) write(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(f()))
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *Histogram) kind() string { return "histogram" }
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer, name string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, b := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(b), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(n)
+		sb.WriteString(`="`)
+		sb.WriteString(labelEscaper.Replace(values[i]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	rejected := r.Counter("test_rejected_total", "Rejected connections.", "reason")
+	rejected.Inc("timeout")
+	rejected.Add(2, `bad "line"`)
+	r.Counter("test_accepted_total", "Accepted\nconnections.")
+	r.Gauge("test_saturation", "Throttle saturation.").Set(0.5)
+	r.GaugeFunc("test_difficulty", "Current difficulty.", func() float64 { return 20 })
+	h := r.Histogram("test_verify_seconds", "Verify latency.", []float64{0.1, 0.01})
+	h.Observe(0.005)
+	h.Observe(0.01)
+	h.Observe(3)
+
+	var sb strings.Builder
+	n, err := r.WriteTo(&sb)
+	if err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	want := `# HELP test_accepted_total Accepted\nconnections.
+# TYPE test_accepted_total counter
+test_accepted_total 0
+# HELP test_difficulty Current difficulty.
+# TYPE test_difficulty gauge
+test_difficulty 20
+# HELP test_rejected_total Rejected connections.
+# TYPE test_rejected_total counter
+test_rejected_total{reason="bad \"line\""} 2
+test_rejected_total{reason="timeout"} 1
+# HELP test_saturation Throttle saturation.
+# TYPE test_saturation gauge
+test_saturation 0.5
+# HELP test_verify_seconds Verify latency.
+# TYPE test_verify_seconds histogram
+test_verify_seconds_bucket{le="0.01"} 2
+test_verify_seconds_bucket{le="0.1"} 2
+test_verify_seconds_bucket{le="+Inf"} 3
+test_verify_seconds_sum 3.015
+test_verify_seconds_count 3
+`
+	if got := sb.String(); got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+	if n != int64(sb.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", sb.Len(), n)
+	}
+}
+
+func TestRegistry_RegisterTwice(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("test_total", "Test.")
+	if r.Counter("test_total", "Test.") != c {
+		t.Error("Expected the registered counter to be returned")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering another kind under the name to panic")
+		}
+	}()
+	r.Gauge("test_total", "Test.")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Test.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("Expected content type %q, got %q", contentType, ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_total 1\n") {
+		t.Errorf("Expected counter in body, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,225 @@
+// Package slog adapts a log/slog handler to the log.Logger interface.
+package slog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	"wise-tcp/pkg/log"
+)
+
+// LevelFatal is the slog level of fatal entries, which slog lacks.
+const LevelFatal = slog.LevelError + 4
+
+// callerSkip is the number of frames between runtime.Callers and the code
+// calling the log package functions.
+const callerSkip = 4
+
+type Logger struct {
+	handler slog.Handler
+	json    bool
+	name    string
+	levels  *log.Levels
+	// component is the name given with Named, logged as "logger".
+	component string
+	out       io.Writer
+	skip      int
+	exit      func(code int)
+}
+
+type Option func(l *Logger)
+
+// WithJSON makes the logger write JSON lines instead of text.
+func WithJSON(v bool) Option {
+	return func(l *Logger) {
+		l.json = v
+	}
+}
+
+func WithName(name string) Option {
+	return func(l *Logger) {
+		l.name = name
+	}
+}
+
+// WithLevels sets the levels entries are filtered by, per component. The
+// default is log.DefaultLevels.
+func WithLevels(levels *log.Levels) Option {
+	return func(l *Logger) {
+		l.levels = levels
+	}
+}
+
+// WithOutput sets where entries are written; the default is stderr.
+func WithOutput(w io.Writer) Option {
+	return func(l *Logger) {
+		l.out = w
+	}
+}
+
+func New(opts ...Option) (*Logger, error) {
+	l := &Logger{
+		levels: log.DefaultLevels(),
+		out:    os.Stderr,
+		skip:   callerSkip,
+		exit:   os.Exit,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	// The levels filter instead, so that they can change at runtime.
+	hopts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       slog.LevelDebug,
+		ReplaceAttr: replaceLevel,
+	}
+	if l.json {
+		l.handler = slog.NewJSONHandler(l.out, hopts)
+	} else {
+		l.handler = slog.NewTextHandler(l.out, hopts)
+	}
+	if l.name != "" {
+		l.handler = l.handler.WithAttrs([]slog.Attr{slog.String("name", l.name)})
+	}
+
+	return l, nil
+}
+
+func slogLevel(level log.Level) slog.Level {
+	switch level {
+	case log.LevelDebug:
+		return slog.LevelDebug
+	case log.LevelInfo:
+		return slog.LevelInfo
+	case log.LevelWarn:
+		return slog.LevelWarn
+	case log.LevelError:
+		return slog.LevelError
+	default:
+		return LevelFatal
+	}
+}
+
+// replaceLevel names LevelFatal, which slog would print as "ERROR+4".
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if lvl, ok := a.Value.Any().(slog.Level); ok && lvl == LevelFatal {
+			a.Value = slog.StringValue("FATAL")
+		}
+	}
+	return a
+}
+
+// With returns a logger that adds keysAndValues to every entry as slog
+// attributes.
+func (l *Logger) With(keysAndValues ...interface{}) log.Logger {
+	child := *l
+	// Derived loggers are called directly instead of through the log
+	// package functions.
+	child.skip = callerSkip - 1
+	r := slog.Record{}
+	r.Add(keysAndValues...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	child.handler = l.handler.WithAttrs(attrs)
+	return &child
+}
+
+// Named returns a logger for the named component. Nested names are joined
+// with dots, as log.Levels expects.
+func (l *Logger) Named(name string) log.Logger {
+	child := *l
+	child.skip = callerSkip - 1
+	if l.component != "" {
+		name = l.component + "." + name
+	}
+	child.component = name
+	return &child
+}
+
+func (l *Logger) log(level log.Level, msg string, keysAndValues []interface{}) {
+	if level != log.LevelFatal && !l.levels.Enabled(l.component, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(l.skip, pcs[:])
+	r := slog.NewRecord(time.Now(), slogLevel(level), msg, pcs[0])
+	if l.component != "" {
+		r.AddAttrs(slog.String("logger", l.component))
+	}
+	r.Add(keysAndValues...)
+	_ = l.handler.Handle(context.Background(), r)
+}
+
+func (l *Logger) Info(args ...interface{}) {
+	l.log(log.LevelInfo, fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Warn(args ...interface{}) {
+	l.log(log.LevelWarn, fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	l.log(log.LevelError, fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Debug(args ...interface{}) {
+	l.log(log.LevelDebug, fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Fatal(args ...interface{}) {
+	l.log(log.LevelFatal, fmt.Sprint(args...), nil)
+	l.exit(1)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(log.LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(log.LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(log.LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(log.LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.log(log.LevelFatal, fmt.Sprintf(format, args...), nil)
+	l.exit(1)
+}
+
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelInfo, msg, keysAndValues)
+}
+
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelWarn, msg, keysAndValues)
+}
+
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelError, msg, keysAndValues)
+}
+
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelDebug, msg, keysAndValues)
+}
+
+func (l *Logger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.log(log.LevelFatal, msg, keysAndValues)
+	l.exit(1)
+}
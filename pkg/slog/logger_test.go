@@ -0,0 +1,95 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"wise-tcp/pkg/log"
+)
+
+func newTestLogger(t *testing.T, opts ...Option) (*Logger, *bytes.Buffer) {
+	t.Helper()
+	var out bytes.Buffer
+	l, err := New(append([]Option{WithJSON(true), WithOutput(&out)}, opts...)...)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	return l, &out
+}
+
+func decodeEntry(t *testing.T, out *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to decode %q: %v", out.String(), err)
+	}
+	out.Reset()
+	return entry
+}
+
+func TestLogger_With(t *testing.T) {
+	l, out := newTestLogger(t, WithName("test"), WithLevels(log.NewLevels(log.LevelDebug)))
+
+	l.With("conn", 7).Infow("accepted", "addr", "192.0.2.1:5000")
+	entry := decodeEntry(t, out)
+
+	want := map[string]interface{}{
+		"level": "INFO",
+		"msg":   "accepted",
+		"name":  "test",
+		"conn":  float64(7),
+		"addr":  "192.0.2.1:5000",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, entry[k])
+		}
+	}
+
+	// The source is the caller of the derived logger.
+	source, _ := entry["source"].(map[string]interface{})
+	if file, _ := source["file"].(string); filepath.Base(file) != "logger_test.go" {
+		t.Errorf("Expected source in logger_test.go, got %v", entry["source"])
+	}
+}
+
+func TestLogger_Level(t *testing.T) {
+	l, out := newTestLogger(t, WithLevels(log.NewLevels(log.LevelWarn)))
+
+	l.Debug("debug")
+	l.Infof("info %d", 1)
+	if out.Len() != 0 {
+		t.Fatalf("Expected entries below warn to be dropped, got %q", out.String())
+	}
+
+	var code int
+	l.exit = func(c int) { code = c }
+	l.Fatalf("fatal %d", 1)
+	entry := decodeEntry(t, out)
+	if entry["level"] != "FATAL" || entry["msg"] != "fatal 1" {
+		t.Errorf("Expected fatal entry, got %v", entry)
+	}
+	if code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+}
+
+func TestLogger_Named(t *testing.T) {
+	levels := log.NewLevels(log.LevelInfo)
+	l, out := newTestLogger(t, WithLevels(levels))
+	pow := l.Named("server").Named("pow")
+
+	pow.Debug("hidden")
+	if out.Len() != 0 {
+		t.Fatalf("Expected debug entry to be dropped, got %q", out.String())
+	}
+
+	levels.SetComponentLevel("server", log.LevelDebug)
+	pow.Debugw("shown", "conn", 1)
+	entry := decodeEntry(t, out)
+	if entry["logger"] != "server.pow" || entry["msg"] != "shown" {
+		t.Errorf("Expected entry of server.pow, got %v", entry)
+	}
+}
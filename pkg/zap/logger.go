@@ -2,6 +2,9 @@ package zap
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"wise-tcp/pkg/log"
 )
 
 type Config struct {
@@ -13,6 +16,10 @@ type Logger struct {
 	logger *zap.SugaredLogger
 	isProd bool
 	name   string
+	levels *log.Levels
+	// derived is set on loggers returned by With and Named, which are called
+	// directly instead of through the log package functions.
+	derived bool
 }
 
 type Option func(l *Logger)
@@ -29,59 +36,136 @@ func WithName(name string) Option {
 	}
 }
 
-func New(opts ...Option) (*Logger, error) {
-	var zapLogger *zap.Logger
-	var err error
+// WithLevels sets the levels entries are filtered by, per logger name.
+// The default is log.DefaultLevels.
+func WithLevels(levels *log.Levels) Option {
+	return func(l *Logger) {
+		l.levels = levels
+	}
+}
 
-	l := &Logger{}
+func New(opts ...Option) (*Logger, error) {
+	l := &Logger{levels: log.DefaultLevels()}
 
 	for _, opt := range opts {
 		opt(l)
 	}
 
+	var cfg zap.Config
 	if l.isProd {
-		zapLogger, err = zap.NewProduction()
+		cfg = zap.NewProductionConfig()
 	} else {
-		zapLogger, err = zap.NewDevelopment()
-	}
-
-	if err != nil {
-		return nil, err
+		cfg = zap.NewDevelopmentConfig()
 	}
+	// The levels filter instead, so that they can change at runtime.
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 
 	options := []zap.Option{
 		zap.AddCallerSkip(2),
 		zap.AddCaller(),
+		zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return &levelCore{Core: c, levels: l.levels}
+		}),
 	}
 	if l.name != "" {
 		options = append(options, zap.Fields(zap.String("name", l.name)))
 	}
 
-	zapLogger = zapLogger.WithOptions(options...)
+	zapLogger, err := cfg.Build(options...)
+	if err != nil {
+		return nil, err
+	}
 
 	l.logger = zapLogger.Sugar()
 
 	return l, nil
 }
 
+func fromZap(level zapcore.Level) log.Level {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return log.LevelDebug
+	case level == zapcore.InfoLevel:
+		return log.LevelInfo
+	case level == zapcore.WarnLevel:
+		return log.LevelWarn
+	case level == zapcore.ErrorLevel:
+		return log.LevelError
+	default:
+		return log.LevelFatal
+	}
+}
+
+// levelCore filters entries by the levels of their logger name.
+type levelCore struct {
+	zapcore.Core
+	levels *log.Levels
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return fromZap(level) >= c.levels.Min()
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.Enabled(ent.LoggerName, fromZap(ent.Level)) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// With returns a logger that adds keysAndValues to every entry as zap
+// fields.
+func (z *Logger) With(keysAndValues ...interface{}) log.Logger {
+	return z.derive(z.base().With(keysAndValues...))
+}
+
+// Named returns a logger for the named component; zap joins nested names
+// with dots, as log.Levels expects.
+func (z *Logger) Named(name string) log.Logger {
+	return z.derive(z.base().Named(name))
+}
+
+// base returns the sugared logger to derive a logger from, with the caller
+// skip of a derived logger.
+func (z *Logger) base() *zap.SugaredLogger {
+	if z.derived {
+		return z.logger
+	}
+	return z.logger.WithOptions(zap.AddCallerSkip(-1))
+}
+
+func (z *Logger) derive(logger *zap.SugaredLogger) *Logger {
+	return &Logger{
+		logger:  logger,
+		isProd:  z.isProd,
+		name:    z.name,
+		levels:  z.levels,
+		derived: true,
+	}
+}
+
 func (z *Logger) Info(args ...interface{}) {
-	z.logger.Info(args)
+	z.logger.Info(args...)
 }
 
 func (z *Logger) Warn(args ...interface{}) {
-	z.logger.Warn(args)
+	z.logger.Warn(args...)
 }
 
 func (z *Logger) Error(args ...interface{}) {
-	z.logger.Error(args)
+	z.logger.Error(args...)
 }
 
 func (z *Logger) Debug(args ...interface{}) {
-	z.logger.Debug(args)
+	z.logger.Debug(args...)
 }
 
 func (z *Logger) Fatal(args ...interface{}) {
-	z.logger.Fatal(args)
+	z.logger.Fatal(args...)
 }
 
 func (z *Logger) Infof(format string, args ...interface{}) {
@@ -103,3 +187,23 @@ func (z *Logger) Debugf(format string, args ...interface{}) {
 func (z *Logger) Fatalf(format string, args ...interface{}) {
 	z.logger.Fatalf(format, args...)
 }
+
+func (z *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	z.logger.Infow(msg, keysAndValues...)
+}
+
+func (z *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	z.logger.Warnw(msg, keysAndValues...)
+}
+
+func (z *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	z.logger.Errorw(msg, keysAndValues...)
+}
+
+func (z *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	z.logger.Debugw(msg, keysAndValues...)
+}
+
+func (z *Logger) Fatalw(msg string, keysAndValues ...interface{}) {
+	z.logger.Fatalw(msg, keysAndValues...)
+}